@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// ClipboardBackend represents the possible ways to copy the output to the clipboard.
+type ClipboardBackend int
+
+const (
+	ClipboardAuto   ClipboardBackend = iota // Backend to use a native tool if one is installed, and OSC 52 otherwise
+	ClipboardNative                         // Backend to use a native tool such as pbcopy, wl-copy, xclip, or xsel
+	ClipboardOSC52                          // Backend to emit the OSC 52 escape sequence to the terminal
+)
+
+// osc52MaxBytes is the size of the encoded OSC 52 payload above which terminals commonly truncate or drop it.
+const osc52MaxBytes = 100_000
+
+// nativeClipboardTools are the commands tried, in order, to copy to the clipboard natively.
+var nativeClipboardTools = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+}
+
+// parseClipboardBackend converts a single clipboard backend string to a ClipboardBackend enum.
+func parseClipboardBackend(backendString string) (ClipboardBackend, error) {
+	switch backendString {
+	case "auto":
+		return ClipboardAuto, nil
+	case "native":
+		return ClipboardNative, nil
+	case "osc52":
+		return ClipboardOSC52, nil
+	default:
+		return 0, fmt.Errorf("invalid clipboard backend: %s", backendString)
+	}
+}
+
+// findNativeClipboardTool returns the first native clipboard command that is installed, or nil if there is none.
+func findNativeClipboardTool() []string {
+	for _, tool := range nativeClipboardTools {
+		if _, err := exec.LookPath(tool[0]); err == nil {
+			return tool
+		}
+	}
+	return nil
+}
+
+// copyToClipboard copies a string to the clipboard with the --clipboard backend.
+// With auto, a native tool is used if one is installed, and the OSC 52 escape sequence otherwise (e.g., over SSH).
+func copyToClipboard(str []byte) error {
+	if parsedClipboardBackend == ClipboardOSC52 {
+		return copyWithOSC52(str)
+	}
+	tool := findNativeClipboardTool()
+	if tool == nil {
+		if parsedClipboardBackend == ClipboardNative {
+			return fmt.Errorf("failed to copy to clipboard: no clipboard tool found (pbcopy, wl-copy, xclip, or xsel)")
+		}
+		return copyWithOSC52(str)
+	}
+	cmd := exec.Command(tool[0], tool[1:]...)
+	cmd.Stdin = bytes.NewReader(str)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to copy to clipboard: %w", err)
+	}
+	return nil
+}
+
+// copyWithOSC52 copies a string to the clipboard by writing the OSC 52 escape sequence to the controlling terminal,
+// which works over SSH as long as the terminal supports it. Inside tmux, the sequence is wrapped for passthrough.
+// Large payloads are still written, with a warning, since many terminals silently truncate them.
+func copyWithOSC52(str []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(str)
+	if len(encoded) > osc52MaxBytes {
+		slog.Warn("clipboard payload exceeds common OSC 52 limits and was likely truncated by the terminal",
+			slog.String("size", humanize.Bytes(uint64(len(encoded)))), slog.String("limit", humanize.Bytes(osc52MaxBytes)))
+	}
+	seq := "\x1b]52;c;" + encoded + "\x07"
+	if os.Getenv("TMUX") != "" {
+		// tmux forwards escape sequences in a DCS passthrough, with every ESC doubled
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to copy to clipboard: no terminal for OSC 52: %w", err)
+	}
+	defer tty.Close()
+	if _, err := tty.WriteString(seq); err != nil {
+		return fmt.Errorf("failed to copy to clipboard: %w", err)
+	}
+	return nil
+}
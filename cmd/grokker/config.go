@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// configName is the name of the config file of a project, without its extension.
+// Both .gogrep.yaml and .gogrep.json are supported.
+const configName = ".gogrep"
+
+// configAltName is an alternative name of the config file of a project, without an extension and always in YAML.
+const configAltName = ".grokker"
+
+// userConfigPath is the directory and name, without its extension, of the config file used when the working
+// directory has none, relative to the user's home directory (e.g., ~/.config/gogrep/config.yaml).
+const userConfigPath = ".config/gogrep/config"
+
+// profilesKey is the config key under which named profiles are defined, selected with --profile.
+const profilesKey = "profiles"
+
+var (
+	configSource string   // Config file (and profile) that set flags, e.g. "config file .gogrep.yaml, profile frontend"
+	configKeys   []string // Flags set from the config file, in the order they were set
+)
+
+// configPathKeys are the keys whose values are paths, which are relative to the directory of the config file.
+var configPathKeys = []string{"dir", "from-file", "order-from", "output", "prompt-file", "template-file"}
+
+// readConfig reads the config file of the project, found by walking up from the working directory to the root,
+// or else the config file in the user's config directory. It returns nil if there is none.
+// In each directory, .gogrep.yaml (or .gogrep.json) is preferred over .grokker.
+func readConfig() (*viper.Viper, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		v := viper.New()
+		v.SetConfigName(configName)
+		v.AddConfigPath(dir)
+		if ok, err := readConfigFile(v); ok || err != nil {
+			return v, err
+		}
+		if _, err := os.Stat(filepath.Join(dir, configAltName)); err == nil {
+			v := viper.New()
+			v.SetConfigFile(filepath.Join(dir, configAltName))
+			v.SetConfigType("yaml")
+			if _, err := readConfigFile(v); err != nil {
+				return nil, err
+			}
+			return v, nil
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		v := viper.New()
+		v.SetConfigName(filepath.Base(userConfigPath))
+		v.AddConfigPath(filepath.Join(home, filepath.Dir(userConfigPath)))
+		if ok, err := readConfigFile(v); ok || err != nil {
+			return v, err
+		}
+	}
+	return nil, nil
+}
+
+// readConfigFile reads the config file of v and returns true if it exists.
+func readConfigFile(v *viper.Viper) (bool, error) {
+	err := v.ReadInConfig()
+	var notFoundErr viper.ConfigFileNotFoundError
+	if errors.As(err, &notFoundErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return true, nil
+}
+
+// configBaseDir returns the directory that relative paths in the config file of v are resolved against:
+// the directory of the config file if it was found above the working directory, and "" otherwise,
+// in which case paths are left as is.
+func configBaseDir(v *viper.Viper) string {
+	home, _ := os.UserHomeDir()
+	cwd, _ := os.Getwd()
+	dir := filepath.Dir(v.ConfigFileUsed())
+	if dir == cwd || dir == filepath.Join(home, filepath.Dir(userConfigPath)) {
+		return ""
+	}
+	return dir
+}
+
+// resolveConfigPath resolves a relative path from the config file against baseDir.
+// Absolute paths, paths starting with ~, and - (stdin or stdout) are left as is.
+func resolveConfigPath(baseDir, path string) string {
+	if baseDir == "" || path == "" || path == "-" || strings.HasPrefix(path, "~") || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// PersistentPreRunE loads the config file, if any, and uses its values as defaults for the flags.
+// Keys mirror the flag names (e.g., dir-depth: 2), and flags passed explicitly take precedence.
+// With --profile, the values of the named profile take precedence over the top-level values. With --no-config, nothing is loaded.
+func PersistentPreRunE(cmd *cobra.Command, args []string) error {
+	configSource, configKeys = "", nil
+	if noConfig {
+		if configProfile != "" {
+			return fmt.Errorf("--profile cannot be combined with --no-config")
+		}
+		return nil
+	}
+	v, err := readConfig()
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		if configProfile != "" {
+			return fmt.Errorf("profile %s requires a config file (%s.yaml)", configProfile, configName)
+		}
+		return nil
+	}
+
+	// Apply the profile first, so its values are set before the top-level values they override
+	if configProfile != "" {
+		profile := v.Sub(profilesKey + "." + configProfile)
+		if profile == nil {
+			return fmt.Errorf("config file %s has no profile: %s", v.ConfigFileUsed(), configProfile)
+		}
+		configSource = fmt.Sprintf("config file %s, profile %s", v.ConfigFileUsed(), configProfile)
+		if err := applyConfig(cmd, profile, profile.AllKeys(), configSource, configBaseDir(v)); err != nil {
+			return err
+		}
+	} else {
+		configSource = "config file " + v.ConfigFileUsed()
+	}
+	var keys []string
+	for _, key := range v.AllKeys() {
+		if !strings.HasPrefix(key, profilesKey+".") {
+			keys = append(keys, key)
+		}
+	}
+	return applyConfig(cmd, v, keys, "config file "+v.ConfigFileUsed(), configBaseDir(v))
+}
+
+// applyConfig sets the flags named by keys to their values in v, unless they are already set.
+// Flags set on the command line or by a profile are changed, so they take precedence.
+// Relative paths are resolved against baseDir, unless it is "".
+func applyConfig(cmd *cobra.Command, v *viper.Viper, keys []string, source, baseDir string) error {
+	for _, key := range keys {
+		// Reject unknown keys so typos do not go unnoticed; aliases such as since resolve to their flags
+		flag := cmd.Flags().Lookup(key)
+		if flag == nil {
+			return fmt.Errorf("%s has unknown key: %s", source, key)
+		}
+		if flag.Name == "profile" || flag.Name == "no-config" {
+			return fmt.Errorf("%s cannot set %s", source, key)
+		}
+		if flag.Changed {
+			continue
+		}
+		isPath := slices.Contains(configPathKeys, flag.Name)
+		var value string
+		if strings.HasSuffix(flag.Value.Type(), "Slice") {
+			values := v.GetStringSlice(key)
+			if isPath {
+				for i := range values {
+					values[i] = resolveConfigPath(baseDir, values[i])
+				}
+			}
+			value = strings.Join(values, ",")
+		} else if strings.HasSuffix(flag.Value.Type(), "Array") {
+			// Array flags such as --redact-pattern take each value as is, since values may contain commas
+			for _, value := range v.GetStringSlice(key) {
+				if err := cmd.Flags().Set(flag.Name, value); err != nil {
+					return fmt.Errorf("%s has invalid value for %s: %w", source, key, err)
+				}
+			}
+			configKeys = append(configKeys, flag.Name)
+			continue
+		} else {
+			value = v.GetString(key)
+			if isPath {
+				value = resolveConfigPath(baseDir, value)
+			}
+		}
+		if err := cmd.Flags().Set(flag.Name, value); err != nil {
+			return fmt.Errorf("%s has invalid value for %s: %w", source, key, err)
+		}
+		configKeys = append(configKeys, flag.Name)
+	}
+	return nil
+}
+
+// withConfigSource wraps a command's PreRunE so that validation errors name the config file (and profile) that set
+// flags, since those flags are validated with the same checks as flags passed on the command line.
+func withConfigSource(preRunE func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		err := preRunE(cmd, args)
+		if err != nil && len(configKeys) > 0 {
+			return fmt.Errorf("%w (%s set %s)", err, configSource, strings.Join(configKeys, ", "))
+		}
+		return err
+	}
+}
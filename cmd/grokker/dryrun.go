@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// renderDryRun summarizes what a run would process (--dry-run): the number of files, their total size,
+// the number of files and bytes per extension, and the roots they were collected from.
+// It only uses the metadata collected by the walk, so no file contents are read.
+func renderDryRun(entriesByRoot map[string][]Entry) string {
+	var totalFiles int
+	var totalBytes int64
+	filesByExt := make(map[string]int)
+	bytesByExt := make(map[string]int64)
+	var roots []string
+	for _, root := range sortedRoots(entriesByRoot) {
+		entries := entriesByRoot[root]
+		if len(entries) == 0 {
+			continue
+		}
+		roots = append(roots, root)
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Path)
+			if ext == "" {
+				ext = "(none)"
+			}
+			filesByExt[ext]++
+			bytesByExt[ext] += entry.Size
+			totalFiles++
+			totalBytes += entry.Size
+		}
+	}
+
+	exts := make([]string, 0, len(filesByExt))
+	for ext := range filesByExt {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		if filesByExt[exts[i]] != filesByExt[exts[j]] {
+			return filesByExt[exts[i]] > filesByExt[exts[j]]
+		}
+		return exts[i] < exts[j]
+	})
+	var rows [][]string
+	for _, ext := range exts {
+		rows = append(rows, []string{ext, humanize.Comma(int64(filesByExt[ext])), humanize.Bytes(uint64(bytesByExt[ext]))})
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Would process %s files, %s (~%s tokens)\n\n", humanize.Comma(int64(totalFiles)), humanize.Bytes(uint64(totalBytes)), humanize.Comma(estimateTokens(totalBytes))))
+	b.WriteString("Roots:\n")
+	for _, root := range roots {
+		b.WriteString("  " + root + "\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(renderTable([]string{"ext", "files", "bytes"}, rows))
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runGit runs git with the given arguments in the current directory and returns its standard output.
+// Errors include git's standard error, which usually explains what went wrong (e.g., an unknown revision).
+func runGit(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// gitChangedPaths returns the absolute paths of the files that differ from ref in the git work tree containing
+// the current directory (--git-diff), including untracked files if untracked is true (--git-diff-untracked).
+// Renamed files are reported by their new path, and deleted files are reported but no longer exist, so they never match.
+func gitChangedPaths(ref string, untracked bool) (map[string]bool, error) {
+	topLevel, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("git-diff requires a git work tree: %w", err)
+	}
+	root := strings.TrimSpace(string(topLevel))
+	out, err := runGit("diff", "--name-only", "-z", "--find-renames", ref, "--")
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff against %s: %w", ref, err)
+	}
+	if untracked {
+		others, err := runGit("ls-files", "--others", "--exclude-standard", "-z", "--full-name", ":/")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list untracked files: %w", err)
+		}
+		out = append(out, others...)
+	}
+	paths := make(map[string]bool)
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path != "" {
+			paths[filepath.Join(root, path)] = true
+		}
+	}
+	return paths, nil
+}
+
+// isGitChanged returns true if the file at path is one of the changed paths returned by gitChangedPaths.
+// The path is resolved to an absolute path without symlinks, since git reports paths relative to the real work tree.
+func isGitChanged(changed map[string]bool, path string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if realPath, err := filepath.EvalSymlinks(absPath); err == nil {
+		absPath = realPath
+	}
+	return changed[absPath]
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// hasGlobMeta returns true if the path contains any glob metacharacters.
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
+
+// globDirs expands a glob pattern to the directories it matches.
+// In addition to the syntax supported by filepath.Match, a "**" path segment
+// matches zero or more directories (e.g., src/**/components).
+// The returned directories are sorted.
+func globDirs(pattern string) ([]string, error) {
+	var base string
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	if segments[0] == "" {
+		// Absolute pattern
+		base = string(os.PathSeparator)
+		segments = segments[1:]
+	}
+	matches := make(map[string]bool)
+	if err := expandGlobSegments(base, segments, matches); err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for dir := range matches {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// expandGlobSegments matches the remaining pattern segments against the directories under base.
+// Matching directories are added to matches.
+func expandGlobSegments(base string, segments []string, matches map[string]bool) error {
+	if len(segments) == 0 {
+		if base != "" {
+			matches[filepath.Clean(base)] = true
+		}
+		return nil
+	}
+	segment, rest := segments[0], segments[1:]
+	if segment == "" {
+		// Trailing or repeated slash
+		return expandGlobSegments(base, rest, matches)
+	}
+	if !hasGlobMeta(segment) {
+		next := filepath.Join(base, segment)
+		if info, err := os.Stat(next); err != nil || !info.IsDir() {
+			return nil
+		}
+		return expandGlobSegments(next, rest, matches)
+	}
+
+	dir := base
+	if dir == "" {
+		dir = "."
+	}
+	children, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	if segment == "**" {
+		// Match zero directories, then one or more
+		if err := expandGlobSegments(base, rest, matches); err != nil {
+			return err
+		}
+		for _, child := range children {
+			if child.IsDir() {
+				if err := expandGlobSegments(filepath.Join(base, child.Name()), segments, matches); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, child := range children {
+		if !child.IsDir() {
+			continue
+		}
+		ok, err := filepath.Match(segment, child.Name())
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := expandGlobSegments(filepath.Join(base, child.Name()), rest, matches); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
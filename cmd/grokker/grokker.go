@@ -1,26 +1,204 @@
 // grokker is a command-line tool to process files in specified directories for AI prompting.
 // It formats file paths and contents, optionally filters by substrings and extensions,
-// and performs specified actions (print, copy, or both) on the output generated
+// and performs specified actions (print, copy, save, or combinations) on the output generated
 // in the specified formats (tree, list, contents, or combinations).
 //
 // Usage:
 //
-//	grokker [flags]
+//	grokker [flags] [paths...]
 //
 // Flags:
 //
-//	--dir strings        Directories to search (comma-separated, default ["."])
-//	--dir-depth int      Maximum directory depth to search (default -1, meaning infinite)
-//	--ext strings        File extensions to include with leading dot (comma-separated, default []). Example: .ts, .tsx
-//	--substring strings  Substrings to filter files by (comma-separated, default [])
-//	--action strings     Actions to perform: print, copy (comma-separated, default print,copy)
-//	--format strings     Output formats: tree, list, contents (comma-separated, default tree,contents)
+//	--dir strings                     Directories or glob patterns to search (comma-separated, default ["."])
+//	--from-file string                File of newline-separated paths to process instead of searching directories, or - for stdin (default none)
+//	--stdin bool                      Read newline-separated file paths from stdin instead of searching directories (default false)
+//	-0, --null bool                   Separate the paths from --from-file or --stdin by NUL bytes instead of newlines (default false)
+//	--strict bool                     Fail on unreadable files and directories, and on missing paths from --from-file or --stdin (default false)
+//	--git-diff string                 Only include files that differ from a git ref (default HEAD when set without a value)
+//	--git-diff-untracked bool         Also include untracked files with --git-diff (default false)
+//	--dir-depth int                   Maximum directory depth to search, 0 or 1 meaning only the top level (default -1, meaning infinite)
+//	--ext strings                     File extensions to include with leading dot, or to exclude with a leading ! (comma-separated, default []). Example: .ts, !.lock
+//	--substring strings               Substrings to filter files by (comma-separated, default [])
+//	--path-substring strings          Substrings to filter file paths by (comma-separated, default [])
+//	--content-substring strings       Substrings to filter file contents by (comma-separated, default [])
+//	--regex bool                      Interpret --substring values as regular expressions (default false)
+//	--exclude strings                 Substrings to exclude files by (comma-separated, default [])
+//	--no-default-ignores bool         Search directories that are ignored by default, such as node_modules (default false)
+//	--show-ignored bool               Print the directories skipped by the default ignore list (default false)
+//	--include-hidden bool             Include hidden files and directories (default false)
+//	--follow-symlinks bool            Follow symlinked files and directories, skipping cycles (default false)
+//	--exclude-dir strings             Directory names or relative paths to skip (comma-separated, default [])
+//	--case-sensitive bool             Match extensions and path substrings case-sensitively (default false)
+//	--smart-case bool                 Match patterns case-sensitively only if they contain an uppercase letter (default false)
+//	--binary-action string            Treatment of binary files: skip, placeholder, include (default skip)
+//	--include-binary bool             Include binary files as a hex dump, same as --binary-action=include (default false)
+//	--redact bool                     Replace common secrets such as API keys with [REDACTED] in every file, not only .env files (default false)
+//	--redact-pattern stringArray      Regular expression of secrets to redact instead of the built-in patterns (repeatable, default none)
+//	--modified-since string           Only include files modified within a duration (e.g. 24h, 7d) or since a date or RFC3339 time (default none)
+//	--since string                    Alias of --modified-since (default none)
+//	--newer-than string               Alias of --modified-since (default none)
+//	--before string                   Only include files modified before a duration ago (e.g. 7d), a date, or an RFC3339 time (default none)
+//	--older-than string               Alias of --before (default none)
+//	--max-size string                 Skip files larger than this size, e.g. 512KB (default unlimited)
+//	--min-size string                 Skip files smaller than this size, e.g. 1B (default none)
+//	--max-file-size string            Maximum size of files to read, e.g. 100KB, 2MB (default unlimited)
+//	--concurrency int                 Number of files to read concurrently (default number of CPUs)
+//	--tree-stats bool                 Show line counts and byte sizes in the tree format (default false)
+//	--tree-style string               Tree style: auto, plain, unicode (default auto)
+//	--tree-depth int                  Maximum depth to expand in the tree format (default -1, meaning infinite)
+//	--tree-readme-hints bool          Annotate directories in the tree format with the first line of their README (default false)
+//	--sort string                     Order of files within each format: name, modified, size, ext, none (default name)
+//	--reverse bool                    Reverse the --sort order (default false)
+//	--sort-by string                  Order of the per-file table in the stats format: name, size, lines, modtime (default the --sort order)
+//	--truncate-lines int              Maximum bytes per line in the contents format (default 0, meaning unlimited)
+//	--template string                 Go template for each file in the contents format, e.g. '{{.Path}}:\n{{.Content}}' (default none)
+//	--template-file string            File to read the --template from (default none)
+//	--markdown bool                   Emit the contents format as markdown with fenced code blocks (default false)
+//	--file-header string              Header before each file in the contents format, with {path} and {ext} placeholders (default '# {path}\n')
+//	--file-footer string              Footer after each file in the contents format, with {path} and {ext} placeholders (default '\n')
+//	--header-template string          Go template for the header before each file in the contents format (default '# {{.Path}}')
+//	--line-numbers bool               Prefix each line in the contents format with its line number (default false)
+//	--readme-first bool               Emit README files first within each directory in the contents format (default false)
+//	--order-from string               File listing paths in the order to emit them in the contents format (default none)
+//	--contents-ordering string        Order of files in the contents format: walk, imports-first (default walk)
+//	--list-tokens bool                Show estimated tokens per file in the list format (default false)
+//	--list-modtime bool               Show the modification time of each file in the list format (default false)
+//	--max-tokens int                  Maximum estimated tokens of the output (default 0, meaning unlimited)
+//	--truncate bool                   Drop the largest files until the output fits --max-tokens (default false)
+//	--progressive-detail bool         Reduce detail until the output fits --max-tokens (default false)
+//	--max-files int                   Confirm before processing more than this many files (default 50, 0 means never, -1 always)
+//	--confirm-threshold int           Alias of --max-files (default 50)
+//	--confirm-threshold-bytes string  Confirm before processing more than this many bytes, e.g. 1MB (default 1MB)
+//	-y, --yes bool                    Skip the confirmation prompt (default false)
+//	--no-confirm bool                 Alias of --yes (default false)
+//	--sample int                      Select N files at random from the matched files (default 0, meaning all)
+//	--seed int                        Random seed for --sample (default random)
+//	--action strings                  Actions to perform: print, copy, save (comma-separated, default print,copy)
+//	--clipboard string                Clipboard backend for the copy action: auto, native, osc52 (default auto)
+//	--max-copy-size string            Largest output to copy to the clipboard, e.g. 2MB, or 0 for unlimited (default 10MB)
+//	--force-copy bool                 Copy outputs larger than --max-copy-size anyway (default false)
+//	--interactive bool                Pick the files in a terminal picker before rendering (default false)
+//	--watch bool                      Rerun whenever files change (default false)
+//	-o, --output string               File to write the output to, or - for stdout (default none)
+//	--split-by-root bool              Write a separate --output file for each directory (default false)
+//	--force bool                      Overwrite the --output file if it exists (default false)
+//	--count-only bool                 Print only the number of matched files (default false)
+//	--dry-run bool                    List and summarize the files that would be processed, without rendering or acting (default false)
+//	--relative bool                   Emit paths relative to the current directory, keeping absolute paths outside of it (default false)
+//	--format strings                  Output formats: tree, list, contents, summary, stats, matches, xml, signatures, paths0 (comma-separated, default tree,contents)
+//	--route strings                   Formats to route to their own action, e.g. tree=print (repeatable, default none)
+//	--format-separator string         Separator between formats, with escape sequences such as \n (default \n\n)
+//	-C, --context int                 Lines of context around each matching line in the matches format (default 0)
+//	--stats string                    Summarize the files after the output: stderr, append (default stderr when set without a value)
+//	--prefix string                   Text to add before the output, with escape sequences such as \n (default none)
+//	--suffix string                   Text to add after the output, with escape sequences such as \n (default none)
+//	--profile string                  Named profile from the config file to apply (default none)
+//	--no-config bool                  Skip loading the config file (default false)
+//	--log-json bool                   Write logs as JSON (default false)
+//	--log-level string                Minimum level of logs to write: debug, info, warn, error (default info)
+//	--prompt string                   Instructions to add to the output, with template fields such as {{.FileCount}} (default none)
+//	--prompt-file string              File to read the --prompt text from (default none)
+//	--prompt-position string          Where to place the prompt: start, end (default start)
+//	--on-invalid-utf8 string          Treatment of invalid UTF-8 in the output: error, replace, keep (default replace)
 //
 // If no directories are provided, it searches the current directory.
+// With --git-diff, only the files that differ from a git ref (HEAD by default) are included, intersected with --dir.
+// Positional arguments are paths: directories are searched like --dir (replacing the default of the current directory),
+// and files are included directly regardless of --ext. A file reached from both is included once.
+// With --from-file, newline-separated file paths are read from a file (or stdin with - or --stdin) instead (e.g., from
+// git diff --name-only); blank lines and # comments are ignored, and missing paths are logged and skipped unless --strict is set.
+// Files and directories that cannot be read are skipped and counted in a summary at the end, or fail the run with --strict.
+// With -0, the paths are NUL-separated instead (e.g., from find -print0).
+// Directories may be glob patterns (e.g., apps/*/src); a ** segment matches zero or more directories.
 // If no extensions are provided, all files are processed.
 // If no substrings are provided, all files (filtered by extensions if provided) are included.
+// Substrings are matched against paths and contents once up front, so every format includes the same files.
+// With --regex, substrings are interpreted as Go regular expressions (e.g., "func .*Handler" or "TODO|FIXME").
+// --path-substring only matches paths and is applied before any file is read, while --content-substring only matches contents.
+// If any --exclude substrings match a file's path or contents, the file is excluded from all formats, even if it matches --substring.
+// Directories whose name or relative path matches --exclude-dir are skipped entirely during the walk.
+// Well-known junk directories (.git, node_modules, vendor, .venv, target, dist, build) are skipped unless --no-default-ignores is set.
+// Symlinks are skipped (and logged) unless --follow-symlinks is set. When following symlinks, a symlinked directory that
+// resolves to a directory already walked (such as a parent) is skipped, so cycles cannot cause infinite loops,
+// and a file reachable through several links is included once.
+// Hidden files and directories (names beginning with a dot) are skipped unless --include-hidden is set.
+// Extensions and path substrings are matched case-insensitively unless --case-sensitive is set. With --smart-case, each
+// pattern is matched case-sensitively only if it contains an uppercase letter, including against file contents.
+// With --modified-since (or --since, --newer-than), only files modified within a duration (e.g., 24h or 7d) or since a date
+// (e.g., 2024-06-01) or RFC3339 timestamp are included. With --before (or --older-than), only files modified before a duration
+// ago, a date, or an RFC3339 timestamp are included; both combine into a range. --list-modtime shows the times in the list format.
+// Files larger than --max-size or smaller than --min-size are skipped entirely during the walk.
+// Files larger than --max-file-size are still listed (and annotated as skipped in the tree) but their contents are not read.
+// Files are read in parallel by --concurrency workers; the output order does not depend on the number of workers.
+// Binary files (with a NUL byte in the first 512 bytes) are listed but skipped in the contents format; --binary-action=placeholder
+// emits a placeholder instead and --binary-action=include (or --include-binary) a hex dump.
+// With --redact, common secrets (API keys, tokens, private keys) are replaced with [REDACTED] in the contents, signatures,
+// and xml formats; .env-like files are redacted unless --redact=false. --redact-pattern replaces the built-in patterns.
+// Before processing more than --max-files (or --confirm-threshold) files (default 50; 0 never asks, even by size, and -1 always asks) or --confirm-threshold-bytes bytes (by default only when stdin is a terminal), grokker asks for confirmation unless --yes (or --no-confirm) is set.
+// With --interactive, the files are picked by hand in a terminal picker (with fuzzy search) before any format is rendered.
+// If confirmation is required but stdin is not a terminal, grokker fails instead of waiting for input.
+// The tree format draws ├──, └──, and │ connectors when stdout is a terminal and indents by two spaces otherwise (--tree-style).
+// Directories are listed before files within each level.
+// The --tree-depth flag collapses deeper directories in the tree format to "dir/ (N files)"; other formats still include their files.
+// With --tree-readme-hints, directories in the tree format are annotated with the first meaningful line of their README.
+// The --sort flag orders files within each format by name, modification time (newest first), size (largest first), or walk order.
+// With --contents-ordering=imports-first, files imported by other files (Go, JavaScript/TypeScript, Python) are emitted first.
+// With --order-from, the files listed in the given file (one path per line) are emitted first in the contents format, in the order listed.
+// With --readme-first, README files are emitted before the other files of their directory in the contents format.
+// With --markdown, each file in the contents format is a "## path" heading followed by a code block fenced with ``` and tagged with the extension.
+// With --file-header and --file-footer, the "# path" header and the blank line after each file in the contents format are
+// replaced, with {path} and {ext} replaced by the path and extension (e.g., --file-header='<file path="{path}">\n').
+// With --header-template, the header before each file is a Go text/template with the fields .Path, .RelPath, .Ext, .Lines, and .Bytes.
+// With --template, each file in the contents format is rendered with a Go text/template instead of "# path",
+// with the fields .Path, .RelPath, .Ext, .Content, .Lines, and .Bytes and escape sequences such as \n interpreted.
+// With --template-file, the template is read from a file once at startup, without interpreting escape sequences.
+// With --truncate-lines, lines in the contents format longer than the given number of bytes are cut and marked with "…".
+// With --line-numbers, each line in the contents format is prefixed with its line number (e.g., "  42 | "); the "# path" header is not numbered.
+// Tokens are estimated at ~4 characters per token. With --max-tokens, output over the budget is an error
+// unless --truncate is passed, in which case the largest files are dropped until the output fits.
+// With --progressive-detail, grokker instead tries full contents, then the head and tail of each file, then the tree and list only,
+// and uses the richest level that fits.
+// The --sample flag selects N files at random (reproducible with --seed), so output is no longer exhaustive.
 // The --action flag specifies the actions to perform on the output (e.g., print, copy, print,copy).
+// The copy action uses pbcopy, wl-copy, xclip, or xsel if installed, and the OSC 52 escape sequence otherwise (--clipboard).
+// The save action writes the --output file and copies the output to the clipboard together: the file is only replaced
+// once the copy succeeds, so a failure leaves neither changed.
+// Outputs over --max-copy-size are not copied (the save action fails instead) unless --force-copy is set.
 // The --format flag specifies the output formats to generate and concatenate (e.g., tree, contents, tree,contents).
+// The --prompt and --prompt-file flags add instructions, a Go template with {{.FileCount}}, {{.TotalTokens}}, and {{.Tree}},
+// before (or with --prompt-position=end, after) the output, identically for every action.
+// Before the actions run, invalid UTF-8 in the output is replaced, rejected, or kept according to --on-invalid-utf8.
+// With --watch, grokker reruns the same query (including the actions) whenever files in the directories change.
+// The --output flag writes the output to a file (or stdout with -) in addition to the actions; existing files require --force.
+// With only the print action and --output, the output is streamed as it is rendered instead of being held in memory.
+// With --split-by-root, a separate --output file is written for each directory, named like out-apps_web.txt.
+// The --route flag sends each format to its own action instead (e.g., --route tree=print --route contents=copy).
+// With --stats, a summary of the files (as in the stats format) is written to stderr after the output, followed by the
+// estimated tokens of the whole output, or with --stats=append appended to the output itself, after a --- divider,
+// so the copy action and --output include it.
+// The --prefix and --suffix flags add text before and after the output (e.g., --prefix='<context>\n'), inside any prompt.
+// The --format-separator flag specifies the string between formats, with escape sequences such as \n interpreted.
+// If a .gogrep.yaml, .gogrep.json, or .grokker file is present in the current directory or above (or else ~/.config/gogrep/config.yaml),
+// the nearest one's values (keyed by flag name) are used as defaults for the flags; flags passed on the command line take precedence.
+// With --profile, the values of a named profile under the profiles key override the defaults. --no-config skips the file.
+// Logs are written to stderr as text, or as JSON with --log-json, at --log-level or higher.
+// On SIGINT or SIGTERM, grokker stops walking and reading files promptly and exits without performing the actions,
+// except for output already streamed; a second signal exits immediately.
+// With --relative, paths in every format are relative to the current directory, unless the file is outside of it.
+// With --count-only, grokker prints only the number of matched files, without rendering formats, prompting, or acting.
+// With --dry-run, grokker lists the files it would process instead, one per line, followed on stderr by the number of files,
+// total bytes, per-extension counts, and roots.
+// The summary format prints a table of lines, bytes, and estimated tokens (~4 characters per token) per file and in total.
+// The stats format prints the number of files, bytes, lines, and estimated tokens, a table of the lines, bytes, extension,
+// and modification time of each file (ordered by --sort-by), a per-extension breakdown sorted by bytes, and the number
+// of files skipped by the default ignores, size limits, and binary detection.
+// The xml format prints a <files> document with nested <dir> elements and one <file path="..."> element per file,
+// its contents wrapped in CDATA so <, >, and & need no escaping. Without files, it prints an empty <files></files> document.
+// The matches format prints the lines that match --substring or --content-substring like grep -n, as path:line: text,
+// with -C (--context) lines around each match and -- between groups of lines that are not adjacent.
+// The paths0 format prints the paths like the list format, but each terminated by a NUL byte for xargs -0.
+// The signatures format prints Go files as their package clause, imports, types, and function signatures with bodies
+// elided as { ... }, keeping doc comments on exported identifiers; other files are printed in full.
 //
 // Examples:
 //
@@ -33,92 +211,203 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math/rand/v2"
 	"os"
-	"os/exec"
+	"os/signal"
+	"os/user"
 	"path/filepath"
 	"regexp"
-	"sort"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/dustin/go-humanize"
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/zaydek/grokker/lib/logutils"
 )
 
-// TreeNode represents a node in the directory tree, with a flag to distinguish directories from files.
-type TreeNode struct {
-	IsDir    bool
-	Children map[string]*TreeNode
-}
-
-// Insert adds a path into the tree structure, respecting whether it’s a file or directory.
-func Insert(node *TreeNode, parts []string, isDir bool) {
-	if len(parts) == 0 {
-		return
-	}
-	part := parts[0]
-	if _, ok := node.Children[part]; !ok {
-		// Intermediate parts are directories; last part uses isDir
-		node.Children[part] = &TreeNode{
-			IsDir:    len(parts) > 1 || isDir,
-			Children: make(map[string]*TreeNode),
-		}
-	}
-	if len(parts) > 1 {
-		Insert(node.Children[part], parts[1:], isDir)
-	} else {
-		node.Children[part].IsDir = isDir
-	}
-}
-
-// Print generates a hierarchical string representation of the tree.
-func Print(node *TreeNode, indent string) string {
-	var keys []string
-	for k := range node.Children {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	var b strings.Builder
-	for _, key := range keys {
-		child := node.Children[key]
-		if child.IsDir {
-			b.WriteString(indent + key + "/\n")
-			b.WriteString(Print(child, indent+"  "))
-		} else {
-			b.WriteString(indent + key + "\n")
-		}
-	}
-	return b.String()
-}
-
 // Action represents the possible actions that can be performed on the output.
 type Action int
 
 const (
 	ActionPrint Action = iota // Action to print the output to the console
 	ActionCopy                // Action to copy the output to the clipboard
+	ActionSave                // Action to write the output to the --output file and copy it to the clipboard
 )
 
 // Format represents the possible output formats.
 type Format int
 
 const (
-	FormatTree     Format = iota // Format to display the directory tree
-	FormatList                   // Format to display the list of filenames
-	FormatContents               // Format to display the contents of the files
+	FormatTree       Format = iota // Format to display the directory tree
+	FormatList                     // Format to display the list of filenames
+	FormatContents                 // Format to display the contents of the files
+	FormatSummary                  // Format to display line, byte, and estimated token counts per file
+	FormatXML                      // Format to display the files and their contents as an XML document
+	FormatSignatures               // Format to display Go files as declarations with function bodies elided
+	FormatPaths0                   // Format to display the list of filenames, each terminated by a NUL byte
+	FormatStats                    // Format to display totals and a per-extension breakdown of the files
+	FormatMatches                  // Format to display the lines that match the substrings, like grep
+)
+
+// InvalidUTF8Policy represents the possible treatments of invalid UTF-8 in the output.
+type InvalidUTF8Policy int
+
+const (
+	InvalidUTF8Replace InvalidUTF8Policy = iota // Policy to replace invalid bytes with the Unicode replacement character
+	InvalidUTF8Error                            // Policy to fail when the output contains invalid bytes
+	InvalidUTF8Keep                             // Policy to keep the output as is
+)
+
+// BinaryAction represents the possible treatments of binary files in the contents and xml formats.
+type BinaryAction int
+
+const (
+	BinaryActionSkip        BinaryAction = iota // Action to omit binary files entirely
+	BinaryActionPlaceholder                     // Action to emit a placeholder instead of the contents
+	BinaryActionInclude                         // Action to include the contents as a hex dump
 )
 
 // Command-line flags
 var (
-	dirs       []string
-	dirDepth   int
-	exts       []string
-	substrings []string
-	actions    []string
-	formats    []string
+	dirs               []string
+	dirDepth           int
+	readStdin          bool
+	fromFile           string
+	nullSeparated      bool
+	strict             bool
+	gitDiff            string
+	gitDiffUntracked   bool
+	exts               []string
+	substrings         []string
+	pathSubstrings     []string
+	contentSubstrings  []string
+	useRegex           bool
+	excludes           []string
+	excludeDirs        []string
+	followSymlinks     bool
+	includeHidden      bool
+	noDefaultIgnores   bool
+	showIgnored        bool
+	caseSensitive      bool
+	smartCase          bool
+	maxFileSize        string
+	maxSize            string
+	minSize            string
+	modifiedSince      string
+	modifiedBefore     string
+	concurrency        int
+	includeBinary      bool
+	redact             bool
+	redactPatterns     []string
+	binaryAction       string
+	treeStats          bool
+	treeStyle          string
+	treeDepth          int
+	treeReadmeHints    bool
+	contentsOrdering   string
+	orderFrom          string
+	readmeFirst        bool
+	lineNumbers        bool
+	markdown           bool
+	fileHeader         string
+	fileFooter         string
+	headerTemplate     string
+	templateText       string
+	templateFile       string
+	truncateLinesBytes int
+	sortOrder          string
+	reverseSort        bool
+	sortBy             string
+	listTokens         bool
+	listModTime        bool
+	maxTokens          int
+	truncate           bool
+	progressiveDetail  bool
+	confirmThreshold   string
+	maxFiles           int
+	yes                bool
+	sample             int
+	seed               int64
+	actions            []string
+	clipboard          string
+	maxCopySize        string
+	forceCopy          bool
+	formats            []string
+	countOnly          bool
+	dryRun             bool
+	relative           bool
+	routes             []string
+	formatSep          string
+	contextLines       int
+	showStats          string
+	prefix             string
+	suffix             string
+	watch              bool
+	interactive        bool
+	onInvalidUTF8      string
+	promptText         string
+	promptFile         string
+	promptPosition     string
+	logJSON            bool
+	configProfile      string
+	noConfig           bool
+	logLevel           string
+	output             string
+	splitByRoot        bool
+	force              bool
+)
+
+// Parsed command-line flags
+var (
+	maxSizeBytes           uint64             // Parsed from --max-size; 0 means unlimited
+	minSizeBytes           uint64             // Parsed from --min-size; 0 means no minimum
+	maxFileSizeBytes       uint64             // Parsed from --max-file-size; 0 means unlimited
+	confirmThresholdBytes  uint64             // Parsed from --confirm-threshold-bytes; 0 means never confirm by size
+	parsedFormatSeparator  string             // Parsed from --format-separator with escape sequences interpreted
+	substringRegexes       []*regexp.Regexp   // Compiled from --substring when --regex is set
+	pathSubstringRegexes   []*regexp.Regexp   // Compiled from --path-substring when --regex is set
+	contentRegexes         []*regexp.Regexp   // Compiled from --content-substring when --regex is set
+	parsedContentsOrdering ContentsOrdering   // Parsed from --contents-ordering
+	parsedSortOrder        SortOrder          // Parsed from --sort
+	includedExts           []string           // Extensions from --ext without a ! prefix
+	excludedExts           []string           // Extensions from --ext with a ! prefix, without the !
+	parsedStatsSortKey     StatsSortKey       // Parsed from --sort-by
+	orderFromPaths         []string           // Read from the --order-from file
+	parsedRoutes           []Route            // Parsed from --route
+	modifiedSinceTime      time.Time          // Parsed from --modified-since; zero means any time
+	modifiedBeforeTime     time.Time          // Parsed from --before; zero means any time
+	parsedTemplate         *template.Template // Compiled from --template; nil means the default "# path" format
+	parsedBinaryAction     BinaryAction       // Parsed from --binary-action, or include with --include-binary
+	argFiles               []string           // Files passed as positional arguments; directories are added to --dir
+	parsedPrompt           *template.Template // Compiled from --prompt or --prompt-file; nil means no prompt
+	parsedPromptPosition   PromptPosition     // Parsed from --prompt-position
+	parsedClipboardBackend ClipboardBackend   // Parsed from --clipboard
+	maxCopySizeBytes       uint64             // Parsed from --max-copy-size; 0 means unlimited
+	parsedStatsMode        StatsMode          // Parsed from --stats
+	parsedPrefix           string             // Parsed from --prefix with escape sequences interpreted
+	parsedSuffix           string             // Parsed from --suffix with escape sequences interpreted
+	parsedFileHeader       string             // Parsed from --file-header with escape sequences interpreted
+	parsedFileFooter       string             // Parsed from --file-footer with escape sequences interpreted
+	parsedHeaderTemplate   *template.Template // Compiled from --header-template; nil means the default "# path" header
+	parsedRedactRegexes    []*regexp.Regexp   // Compiled from --redact-pattern, or the default secret patterns
+	redactAllFiles         bool               // Whether to redact every file, with --redact or --redact-pattern
+	redactEnvFiles         bool               // Whether to redact .env-like files, unless --redact=false
 )
 
 // Styles for the help message
@@ -135,7 +424,10 @@ var (
 	StyleFaintUnderline = lipgloss.NewStyle().Faint(true).Underline(true)
 )
 
-var threeOrMoreNewlinesRegex = regexp.MustCompile(`\n{3,}`)
+var (
+	threeOrMoreNewlinesRegex = regexp.MustCompile(`\n{3,}`)
+	backtickRunsRegex        = regexp.MustCompile("`+")
+)
 
 // parseAction converts a single action string to an Action enum.
 func parseAction(actionString string) (Action, error) {
@@ -144,11 +436,83 @@ func parseAction(actionString string) (Action, error) {
 		return ActionPrint, nil
 	case "copy":
 		return ActionCopy, nil
+	case "save":
+		return ActionSave, nil
 	default:
 		return 0, fmt.Errorf("invalid action: %s", actionString)
 	}
 }
 
+// parseTreeStyle converts a single tree style string to a TreeStyle enum.
+func parseTreeStyle(treeStyleString string) (TreeStyle, error) {
+	switch treeStyleString {
+	case "plain":
+		return TreeStylePlain, nil
+	case "unicode":
+		return TreeStyleUnicode, nil
+	default:
+		return 0, fmt.Errorf("invalid tree style: %s", treeStyleString)
+	}
+}
+
+// parseInvalidUTF8Policy converts a single policy string to an InvalidUTF8Policy enum.
+func parseInvalidUTF8Policy(policyString string) (InvalidUTF8Policy, error) {
+	switch policyString {
+	case "replace":
+		return InvalidUTF8Replace, nil
+	case "error":
+		return InvalidUTF8Error, nil
+	case "keep":
+		return InvalidUTF8Keep, nil
+	default:
+		return 0, fmt.Errorf("invalid policy: %s", policyString)
+	}
+}
+
+// parseBinaryAction converts a single binary action string to a BinaryAction enum.
+func parseBinaryAction(actionString string) (BinaryAction, error) {
+	switch actionString {
+	case "skip":
+		return BinaryActionSkip, nil
+	case "placeholder":
+		return BinaryActionPlaceholder, nil
+	case "include":
+		return BinaryActionInclude, nil
+	default:
+		return 0, fmt.Errorf("invalid binary action: %s", actionString)
+	}
+}
+
+// parseSortOrder converts a single sort order string to a SortOrder enum.
+func parseSortOrder(sortString string) (SortOrder, error) {
+	switch sortString {
+	case "name":
+		return SortName, nil
+	case "modified", "modtime":
+		return SortModified, nil
+	case "size":
+		return SortSize, nil
+	case "none":
+		return SortNone, nil
+	case "ext":
+		return SortExt, nil
+	default:
+		return 0, fmt.Errorf("invalid sort order: %s", sortString)
+	}
+}
+
+// parseContentsOrdering converts a single contents ordering string to a ContentsOrdering enum.
+func parseContentsOrdering(orderingString string) (ContentsOrdering, error) {
+	switch orderingString {
+	case "walk":
+		return ContentsOrderingWalk, nil
+	case "imports-first":
+		return ContentsOrderingImportsFirst, nil
+	default:
+		return 0, fmt.Errorf("invalid contents ordering: %s", orderingString)
+	}
+}
+
 // parseFormat converts a single format string to a Format enum.
 func parseFormat(formatString string) (Format, error) {
 	switch formatString {
@@ -158,28 +522,90 @@ func parseFormat(formatString string) (Format, error) {
 		return FormatList, nil
 	case "contents":
 		return FormatContents, nil
+	case "summary":
+		return FormatSummary, nil
+	case "xml":
+		return FormatXML, nil
+	case "signatures":
+		return FormatSignatures, nil
+	case "paths0":
+		return FormatPaths0, nil
+	case "stats":
+		return FormatStats, nil
+	case "matches":
+		return FormatMatches, nil
 	default:
 		return 0, fmt.Errorf("invalid format: %s", formatString)
 	}
 }
 
-// expandTilde replaces ~ with the user's home directory in the given path.
-// If the path does not start with ~, it is returned as is.
+// parseSince converts a duration (e.g., 24h or 7d), an RFC3339 timestamp, or a date (e.g., 2024-06-01) to the time it refers to.
+// Durations are measured back from now, and the d suffix is a number of 24-hour days. Dates are midnight in local time.
+func parseSince(sinceString string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(sinceString, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("invalid duration: %s", sinceString)
+		}
+		return now.Add(-time.Duration(n) * 24 * time.Hour), nil
+	}
+	if duration, err := time.ParseDuration(sinceString); err == nil && duration >= 0 {
+		return now.Add(-duration), nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, sinceString, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, sinceString)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid duration, timestamp, or date: %s", sinceString)
+	}
+	return t, nil
+}
+
+// isModifiedInRange returns true if the modification time is not before --modified-since and is before --before.
+func isModifiedInRange(modTime time.Time) bool {
+	return (modifiedSinceTime.IsZero() || !modTime.Before(modifiedSinceTime)) &&
+		(modifiedBeforeTime.IsZero() || modTime.Before(modifiedBeforeTime))
+}
+
+// expandTilde replaces a leading ~ (as in ~ or ~/src) with the user's home directory in the given path,
+// and a leading ~name (as in ~alice/src) with the home directory of user name, like a shell does.
+// Paths that do not start with ~, and ~name paths for users that do not exist, are returned as is,
+// since a file name can legitimately start with ~.
 func expandTilde(path string) (string, error) {
-	if strings.HasPrefix(path, "~") {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+	name, rest, _ := strings.Cut(filepath.ToSlash(path[1:]), "/")
+	if name == "" {
 		home, err := os.UserHomeDir()
 		if err != nil {
 			return "", fmt.Errorf("failed to get user's home directory: %w", err)
 		}
-		return filepath.Join(home, path[1:]), nil
+		return filepath.Join(home, rest), nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return path, nil
 	}
-	return path, nil
+	return filepath.Join(u.HomeDir, rest), nil
+}
+
+// unescape interprets Go escape sequences such as \n and \t in a command-line string.
+func unescape(str string) (string, error) {
+	return strconv.Unquote(`"` + strings.ReplaceAll(str, `"`, `\"`) + `"`)
+}
+
+// isExtIncluded returns true if the filename passes the --ext filter: it has none of the negated extensions
+// (e.g., !.lock) and, if any extensions are not negated, one of them.
+func isExtIncluded(filename string) bool {
+	return (len(excludedExts) == 0 || !areExtMatches(filename, excludedExts)) && areExtMatches(filename, includedExts)
 }
 
 // areExtMatches returns true if the filename has any of the specified extensions.
 // If exts is empty, it matches all extensions.
-// The comparison is case-insensitive and requires an exact match.
-// Extensions are expected to include the leading dot (e.g., ".ts").
+// The comparison is case-insensitive unless --case-sensitive (or --smart-case with an uppercase extension) is set,
+// and requires an exact match. Extensions are expected to include the leading dot (e.g., ".ts").
 func areExtMatches(filename string, exts []string) bool {
 	if len(exts) == 0 {
 		return true
@@ -189,304 +615,1994 @@ func areExtMatches(filename string, exts []string) bool {
 		return false
 	}
 	for _, ext := range exts {
-		if strings.EqualFold(filenameExt, ext) {
+		if isCaseSensitive(ext) && filenameExt == ext || !isCaseSensitive(ext) && strings.EqualFold(filenameExt, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultIgnoredDirs are the names of directories that are never useful context, such as VCS metadata,
+// dependencies, and build output. They are skipped during the walk unless --no-default-ignores is set.
+var defaultIgnoredDirs = []string{".git", "node_modules", "vendor", ".venv", "target", "dist", "build"}
+
+// isDefaultIgnoredDir returns true if the directory name is in defaultIgnoredDirs and --no-default-ignores is not set.
+func isDefaultIgnoredDir(name string) bool {
+	return !noDefaultIgnores && slices.Contains(defaultIgnoredDirs, name)
+}
+
+// isHidden returns true if the file or directory name begins with a dot (e.g., .git, .DS_Store).
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// isExcludedDir returns true if the directory's name or path relative to the walk root
+// matches any of the patterns. Patterns use the syntax of filepath.Match, so plain names
+// (e.g., node_modules) and relative paths (e.g., src/generated) match exactly.
+func isExcludedDir(name, relPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = filepath.Clean(pattern)
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, relPath); ok {
 			return true
 		}
 	}
 	return false
 }
 
+// isCaseSensitive returns true if the pattern is matched case-sensitively against paths and extensions:
+// always with --case-sensitive, with --smart-case only if the pattern contains an uppercase letter, and never otherwise.
+func isCaseSensitive(pattern string) bool {
+	return caseSensitive || smartCase && hasUpper(pattern)
+}
+
+// isContentCaseSensitive returns true if the pattern is matched case-sensitively against file contents,
+// which is always the case unless --smart-case is set and the pattern has no uppercase letter.
+func isContentCaseSensitive(pattern string) bool {
+	return !smartCase || hasUpper(pattern)
+}
+
+// hasUpper returns true if s contains an uppercase letter.
+func hasUpper(s string) bool {
+	return strings.IndexFunc(s, unicode.IsUpper) != -1
+}
+
+// pathContains returns true if the path contains the substring, ignoring case unless isCaseSensitive(sub).
+func pathContains(path, sub string) bool {
+	if isCaseSensitive(sub) {
+		return strings.Contains(path, sub)
+	}
+	return strings.Contains(strings.ToLower(path), strings.ToLower(sub))
+}
+
+// contentMatcher matches substrings against the contents of a file. The contents are lowercased at most once,
+// and only if a pattern is matched case-insensitively, since lowercasing whole files is pure overhead otherwise.
+type contentMatcher struct {
+	content string
+	lower   *string // Lowercased content, set on first use
+}
+
+// contains returns true if the content contains the substring, ignoring case unless isContentCaseSensitive(sub).
+func (m *contentMatcher) contains(sub string) bool {
+	if isContentCaseSensitive(sub) {
+		return strings.Contains(m.content, sub)
+	}
+	if m.lower == nil {
+		lower := strings.ToLower(m.content)
+		m.lower = &lower
+	}
+	return strings.Contains(*m.lower, strings.ToLower(sub))
+}
+
 // anySubstringMatches returns true if any of the substrings match the path or content.
 // If substrings is empty, it matches all paths and contents.
-// The comparison is case-insensitive.
+// The path comparison is case-insensitive unless --case-sensitive is set.
+// The content comparison is case-sensitive unless --smart-case is set and the substring is lowercase.
 func anySubstringMatches(substrings []string, path, content string) bool {
 	if len(substrings) == 0 {
 		return true
 	}
+	m := &contentMatcher{content: content}
 	for _, sub := range substrings {
-		if strings.Contains(strings.ToLower(path), strings.ToLower(sub)) || strings.Contains(content, sub) {
+		if pathContains(path, sub) || m.contains(sub) {
 			return true
 		}
 	}
 	return false
 }
 
-// copyToClipboard copies a string to the clipboard using the pbcopy command.
-// Note: This function is only supported on macOS.
-func copyToClipboard(str []byte) error {
-	cmd := exec.Command("pbcopy")
-	cmd.Stdin = bytes.NewReader(str)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to copy to clipboard: %w", err)
+// anyRegexMatches returns true if any of the regular expressions match the path or content.
+// If regexes is empty, it matches all paths and contents.
+func anyRegexMatches(regexes []*regexp.Regexp, path, content string) bool {
+	if len(regexes) == 0 {
+		return true
 	}
-	return nil
+	for _, re := range regexes {
+		if re.MatchString(path) || re.MatchString(content) {
+			return true
+		}
+	}
+	return false
 }
 
-// generateHelpMessage generates the help message for the root command.
-func generateHelpMessage() (string, error) {
-	var b strings.Builder
-	b.WriteString(StyleBoldGreen.Render("grokker") + " is a command-line tool for grokking files " + StyleFaint.Render("(") + StyleFaintUnderline.Render("https://github.com/zaydek/grokker") + StyleFaint.Render(")") + "\n\n")
-	b.WriteString(StyleBoldWhite.Render("Usage: grokker [flags]") + "\n\n")
-	b.WriteString(StyleBoldWhite.Render("Flags:") + "\n")
-	b.WriteString("  " + StyleCyan.Render("--dir") + "        Directories to search (comma-separated, default [.])" + "\n")
-	b.WriteString("  " + StyleCyan.Render("--dir-depth") + "  Maximum directory depth to search (default -1, meaning infinite)" + "\n")
-	b.WriteString("  " + StyleCyan.Render("--ext") + "        File extensions to include with leading dot (comma-separated, default []). Example: .ts, .tsx" + "\n")
-	b.WriteString("  " + StyleCyan.Render("--substring") + "  Substrings to filter by (comma-separated, default [])" + "\n")
-	b.WriteString("  " + StyleCyan.Render("--action") + "     Actions to perform: print, copy (comma-separated, default print,copy)" + "\n")
-	b.WriteString("  " + StyleCyan.Render("--format") + "     Output formats: tree, list, contents (comma-separated, default tree,contents)" + "\n\n")
-	b.WriteString(StyleBoldWhite.Render("Examples:") + "\n")
-	b.WriteString("  " + StyleBlue.Render("grokker") + "                                                                                              " + StyleFaint.Render("Process all files in the current directory and print+copy the contents") + "\n")
-	b.WriteString("  " + StyleBlue.Render("grokker --substring=store --action=print --format=list") + "                                               " + StyleFaint.Render(`Print the list of files with "store" in the path`) + "\n")
-	b.WriteString("  " + StyleBlue.Render("grokker --dir=app --ext=.js --action=copy --format=contents") + "                                          " + StyleFaint.Render("Copy the contents of .js files in app/ to clipboard") + "\n")
-	b.WriteString("  " + StyleBlue.Render("grokker --dir=foo,bar --substring=bar,baz --ext=.ts,.tsx --action=print,copy --format=tree,contents") + "  " + StyleFaint.Render(`Print and copy the tree and contents of .ts/.tsx files with "bar" or "baz"`))
-	return b.String(), nil
+// isIncluded returns true if the file matches the --substring and --content-substring filters.
+// With --regex, the substrings are matched as regular expressions.
+func isIncluded(path, content string) bool {
+	if useRegex {
+		return anyRegexMatches(substringRegexes, path, content) && anyContentRegexMatches(contentRegexes, content)
+	}
+	return anySubstringMatches(substrings, path, content) && anyContentSubstringMatches(contentSubstrings, content)
 }
 
-// Root command definition
-var rootCmd = &cobra.Command{
-	Use:   "grokker",
-	Short: "grokker: Process files for AI prompting",
-	Long: `grokker is a command-line tool designed to process files in specified directories for AI prompting.
-It formats file paths and contents, optionally filters by substrings and extensions,
-and performs specified actions on the output generated in the specified formats.`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		// Print the help message if no arguments are provided
-		if len(os.Args) == 1 {
-			help, _ := generateHelpMessage()
-			fmt.Println(help)
-			os.Exit(0)
-		}
+// isPathIncluded returns true if the path matches the --path-substring filter, which never needs the file contents.
+// The comparison is case-insensitive unless --case-sensitive is set, and with --regex the substrings are regular expressions.
+func isPathIncluded(path string) bool {
+	if useRegex {
+		return len(pathSubstringRegexes) == 0 || slices.ContainsFunc(pathSubstringRegexes, func(re *regexp.Regexp) bool {
+			return re.MatchString(path)
+		})
+	}
+	return len(pathSubstrings) == 0 || slices.ContainsFunc(pathSubstrings, func(sub string) bool {
+		return pathContains(path, sub)
+	})
+}
 
-		// Parse the actions
-		var parsedActions []Action
-		for _, actionStr := range actions {
-			action, _ := parseAction(actionStr)
-			parsedActions = append(parsedActions, action)
-		}
+// anyContentSubstringMatches returns true if any of the substrings match the content, ignoring the path.
+// If substrings is empty, it matches all contents.
+// The comparison is case-sensitive unless --smart-case is set and the substring is lowercase.
+func anyContentSubstringMatches(substrings []string, content string) bool {
+	m := &contentMatcher{content: content}
+	return len(substrings) == 0 || slices.ContainsFunc(substrings, m.contains)
+}
 
-		// Parse the formats
-		var parsedFormats []Format
-		for _, formatStr := range formats {
-			format, _ := parseFormat(formatStr)
-			parsedFormats = append(parsedFormats, format)
-		}
+// anyContentRegexMatches returns true if any of the regular expressions match the content, ignoring the path.
+// If regexes is empty, it matches all contents.
+func anyContentRegexMatches(regexes []*regexp.Regexp, content string) bool {
+	return len(regexes) == 0 || slices.ContainsFunc(regexes, func(re *regexp.Regexp) bool {
+		return re.MatchString(content)
+	})
+}
 
-		// Collect files with depth control and extension filter
-		type Entry struct {
-			Path  string
-			IsDir bool
-			Depth int
+// compileRegexes compiles the values of a substring flag as regular expressions (--regex).
+// With --smart-case, patterns without an uppercase letter are compiled with the (?i) flag to ignore case.
+func compileRegexes(patterns []string) ([]*regexp.Regexp, error) {
+	var regexes []*regexp.Regexp
+	for _, pattern := range patterns {
+		expr := pattern
+		if smartCase && !hasUpper(pattern) {
+			expr = "(?i)" + pattern
 		}
-		entriesByRoot := make(map[string][]Entry)
-		for _, dir := range dirs {
-			entriesByRoot[dir] = []Entry{}
-			err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
-				relPath, err := filepath.Rel(dir, path)
-				if err != nil {
-					return err
-				}
-				var depth int
-				if relPath == "." {
-					depth = 0
-				} else {
-					depth = strings.Count(relPath, string(os.PathSeparator)) + 1
-				}
-				if !info.IsDir() && (dirDepth == -1 || depth <= dirDepth) && areExtMatches(info.Name(), exts) {
-					entriesByRoot[dir] = append(entriesByRoot[dir], Entry{Path: path, IsDir: false, Depth: depth})
-				}
-				return nil
-			})
-			if err != nil {
-				return fmt.Errorf("failed to walk directory: %w", err)
-			}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("regular expression is invalid: %s: %w", pattern, err)
 		}
+		regexes = append(regexes, re)
+	}
+	return regexes, nil
+}
 
-		// Ensure there are files to process
-		if len(entriesByRoot) == 0 {
-			fmt.Println("No files found.")
-			return nil
+// renderTable renders rows as an aligned table with an optional header row.
+// The first column is left-aligned and the remaining columns are right-aligned.
+func renderTable(header []string, rows [][]string) string {
+	allRows := rows
+	if header != nil {
+		allRows = append([][]string{header}, rows...)
+	}
+	var widths []int
+	for _, row := range allRows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], len(cell))
 		}
-
-		// Confirm before processing a large number of files (50+)
-		totalFiles := 0
-		for _, entries := range entriesByRoot {
-			totalFiles += len(entries)
+	}
+	var b strings.Builder
+	for _, row := range allRows {
+		for i, cell := range row {
+			if i == 0 {
+				b.WriteString(cell + strings.Repeat(" ", widths[i]-len(cell)))
+			} else {
+				b.WriteString("  " + strings.Repeat(" ", widths[i]-len(cell)) + cell)
+			}
 		}
-		if totalFiles > 50 {
-			reader := bufio.NewReader(os.Stdin)
-			fmt.Println(StyleBoldRed.Render(fmt.Sprintf("WARNING: Processing %s files. Proceed? [y/N] ", humanize.Comma(int64(totalFiles)))))
-			response, _ := reader.ReadString('\n')
-			if !strings.EqualFold(strings.TrimSpace(response), "y") {
-				fmt.Println("Aborted.")
-				return nil
-			}
-		}
-
-		// Process the files
-		var outputs []string
-		for _, format := range parsedFormats {
-			var output string
-			switch format {
-			case FormatContents:
-				var b strings.Builder
-				for _, entries := range entriesByRoot {
-					for _, entry := range entries {
-						content, err := os.ReadFile(entry.Path)
-						if err != nil {
-							slog.Error("failed to read file", slog.String("path", entry.Path), slog.String("error", err.Error()))
-							continue
-						}
-						contentStr := string(content)
-						if len(substrings) == 0 || anySubstringMatches(substrings, entry.Path, contentStr) {
-							b.WriteString("# " + entry.Path + "\n")
-							b.WriteString(contentStr + "\n\n")
-						}
-					}
-				}
-				output = b.String()
+		b.WriteString("\n")
+	}
+	return b.String()
+}
 
-			case FormatList:
-				var filteredFiles []string
-				for _, entries := range entriesByRoot {
-					for _, entry := range entries {
-						if len(substrings) == 0 || anySubstringMatches(substrings, entry.Path, "") {
-							filteredFiles = append(filteredFiles, entry.Path)
-						}
-					}
-				}
-				sort.Strings(filteredFiles)
-				output = strings.Join(filteredFiles, "\n")
+// binarySniffBytes is the number of leading bytes that isBinary checks for a NUL byte.
+const binarySniffBytes = 512
 
-			case FormatTree:
-				var b strings.Builder
-				for root, entries := range entriesByRoot {
-					rootNode := &TreeNode{IsDir: true, Children: make(map[string]*TreeNode)}
-					hasEntries := false
-					for _, entry := range entries {
-						if len(substrings) == 0 || anySubstringMatches(substrings, entry.Path, "") {
-							relPath, err := filepath.Rel(root, entry.Path)
-							if err != nil {
-								return fmt.Errorf("failed to get relative path: %w", err)
-							}
-							parts := strings.Split(relPath, string(os.PathSeparator))
-							Insert(rootNode, parts, entry.IsDir)
-							hasEntries = true
-						}
-					}
-					if hasEntries {
-						b.WriteString(root + "/\n")
-						b.WriteString(Print(rootNode, "  "))
-					}
-				}
-				output = b.String()
+// isBinary returns true if the content looks like a binary file, with a NUL byte in its first 512 bytes.
+// Text files never contain NUL bytes, and binary formats almost always have one in their header.
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), binarySniffBytes)], 0) != -1
+}
 
-			default:
-				slog.Error("internal error")
-				continue
-			}
-			output = threeOrMoreNewlinesRegex.ReplaceAllString(output, "\n\n")
-			output = strings.TrimSpace(output)
-			outputs = append(outputs, output)
-		}
-		combinedOutput := strings.Join(outputs, "\n\n")
+// countLines returns the number of lines in content.
+// A trailing line without a newline is counted as a line.
+func countLines(content []byte) int {
+	if len(content) == 0 {
+		return 0
+	}
+	lines := bytes.Count(content, []byte("\n"))
+	if content[len(content)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
 
-		// Perform the specified actions
-		for _, action := range parsedActions {
-			switch action {
-			case ActionPrint:
-				fmt.Println(combinedOutput)
-			case ActionCopy:
-				copyToClipboard([]byte(combinedOutput))
-			default:
-				slog.Error("internal error")
-			}
+// formatFileHeader formats the header before a file in the contents format, "# path",
+// --file-header with its placeholders replaced, --header-template, or, with --markdown, a "## path" heading.
+// The content is only used for the fields of --header-template, and is nil if the file was not read.
+func formatFileHeader(entry Entry, content []byte) string {
+	if parsedFileHeader != "" {
+		return replaceFilePlaceholders(parsedFileHeader, entry.Path)
+	}
+	if parsedHeaderTemplate != nil {
+		var lines int
+		if content != nil {
+			lines = countLines(content)
 		}
-		return nil
-	},
+		data := HeaderData{Path: entry.Path, RelPath: entry.RelPath, Ext: filepath.Ext(entry.Path), Lines: lines, Bytes: entry.Size}
+		var b strings.Builder
+		if err := parsedHeaderTemplate.Execute(&b, data); err != nil {
+			slog.Error("failed to execute header template", slog.String("path", entry.Path), slog.String("error", err.Error()))
+			return "# " + entry.Path + "\n"
+		}
+		return b.String() + "\n"
+	}
+	if markdown {
+		return "## " + entry.Path + "\n\n"
+	}
+	return "# " + entry.Path + "\n"
 }
 
-// PreRunE validates the command-line flags before the main command executes.
-func PreRunE(cmd *cobra.Command, args []string) error {
-	// Expand the flag --dir (replace ~ with the user's home directory)
-	var expandedDirs []string
-	for _, dir := range dirs {
-		expanded, err := expandTilde(dir)
-		if err != nil {
-			return err
-		}
-		expandedDirs = append(expandedDirs, expanded)
+// formatFileBlock formats a file in the contents format: the header, the body, and a blank line or,
+// with --file-footer, the footer on its own line.
+func formatFileBlock(entry Entry, content []byte, body string) string {
+	if parsedFileFooter == "" {
+		return formatFileHeader(entry, content) + body + "\n\n"
 	}
-	dirs = expandedDirs
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	return formatFileHeader(entry, content) + body + replaceFilePlaceholders(parsedFileFooter, entry.Path)
+}
 
-	// Validate the flag --dir
-	var invalidDirs []string
-	for _, dir := range dirs {
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
-			invalidDirs = append(invalidDirs, dir)
+// replaceFilePlaceholders replaces {path} and {ext} in --file-header or --file-footer
+// with the path and the extension without its dot (e.g., go).
+func replaceFilePlaceholders(text, path string) string {
+	return strings.NewReplacer("{path}", path, "{ext}", strings.TrimPrefix(filepath.Ext(path), ".")).Replace(text)
+}
+
+// fenceCodeBlock wraps content in a fenced markdown code block tagged with lang (e.g., go).
+// The fence is longer than any run of backticks in content, so content cannot close it early.
+func fenceCodeBlock(content, lang string) string {
+	longest := 0
+	for _, run := range backtickRunsRegex.FindAllString(content, -1) {
+		longest = max(longest, len(run))
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fence + lang + "\n" + strings.TrimSuffix(content, "\n") + "\n" + fence
+}
+
+// truncateLines trims each line of content that exceeds n bytes to at most n bytes and appends "…".
+// Lines are cut at a rune boundary so multi-byte characters are not split.
+func truncateLines(content string, n int) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if len(line) <= n {
+			continue
+		}
+		cut := n
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
 		}
+		lines[i] = line[:cut] + "…"
 	}
-	if len(invalidDirs) > 0 {
-		return fmt.Errorf("directories are invalid: %s", strings.Join(invalidDirs, ", "))
+	return strings.Join(lines, "\n")
+}
+
+// numberLines prefixes each line of content with its right-aligned line number (e.g., "  42 | ").
+// A trailing newline does not start a new numbered line.
+func numberLines(content string) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	width := len(strconv.Itoa(len(lines)))
+	var b strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&b, "%*d | %s\n", width, i+1, line)
 	}
+	return b.String()
+}
 
-	// Validate the flag --dir-depth
-	if dirDepth < -1 {
-		return fmt.Errorf("directory depth is invalid: %d", dirDepth)
+// ensureValidUTF8 replaces, rejects, or keeps invalid UTF-8 in the output according to --on-invalid-utf8.
+func ensureValidUTF8(output string) (string, error) {
+	if utf8.ValidString(output) {
+		return output, nil
+	}
+	policy, _ := parseInvalidUTF8Policy(onInvalidUTF8)
+	switch policy {
+	case InvalidUTF8Replace:
+		return strings.ToValidUTF8(output, string(utf8.RuneError)), nil
+	case InvalidUTF8Error:
+		return "", fmt.Errorf("output is not valid UTF-8; pass --on-invalid-utf8=replace to replace invalid bytes")
 	}
+	return output, nil
+}
 
-	// Validate the flag --ext (ensure all extensions start with a dot)
-	for _, ext := range exts {
-		if !strings.HasPrefix(ext, ".") {
-			return fmt.Errorf("extensions must start with a dot (e.g., .ts): %s", ext)
+// openOutput creates the file at path for writing, creating parent directories as needed.
+// Existing files are only overwritten if force is true.
+func openOutput(path string, force bool) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("output file already exists (pass --force to overwrite): %s", path)
 		}
+		return nil, fmt.Errorf("failed to open output file: %w", err)
 	}
+	return file, nil
+}
 
-	// Validate the flag --action
-	var invalidActions []string
-	for _, action := range actions {
-		if _, err := parseAction(action); err != nil {
-			invalidActions = append(invalidActions, action)
+// isTerminal returns true if the file is a terminal.
+func isTerminal(file *os.File) bool {
+	return isatty.IsTerminal(file.Fd()) || isatty.IsCygwinTerminal(file.Fd())
+}
+
+// writeOutput writes data to the file at path, creating parent directories as needed.
+// If path is "-", data is written to stdout. Existing files are only overwritten if force is true.
+func writeOutput(path string, data []byte, force bool) error {
+	if path == "-" {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
 		}
+		return nil
 	}
-	if len(invalidActions) > 0 {
-		return fmt.Errorf("actions are invalid: %s", strings.Join(invalidActions, ", "))
+	file, err := openOutput(path, force)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write output file: %w", err)
 	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
 
-	// Validate the flag --format
-	var invalidFormats []string
-	for _, format := range formats {
-		if _, err := parseFormat(format); err != nil {
-			invalidFormats = append(invalidFormats, format)
-		}
+// saveOutput writes the output to the file at path and copies it to the clipboard (the save action).
+// The output is written to a temporary file next to path, which replaces path only after the copy succeeds,
+// so the file and the clipboard are either both updated or neither is. Existing files are only overwritten if force is true,
+// and outputs over --max-copy-size are refused unless --force-copy is set.
+func saveOutput(path string, output string, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("output file already exists (pass --force to overwrite): %s", path)
 	}
-	if len(invalidFormats) > 0 {
-		return fmt.Errorf("formats are invalid: %s", strings.Join(invalidFormats, ", "))
+	if !checkCopySize(output) {
+		return fmt.Errorf("output of %s exceeds --max-copy-size of %s (pass --force-copy to save it anyway, or narrow it with --format or --ext)",
+			humanize.Bytes(uint64(len(output))), humanize.Bytes(maxCopySizeBytes))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	data := output
+	if !strings.HasSuffix(data, "\x00") {
+		data += "\n"
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := os.Chmod(file.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := copyToClipboard([]byte(output)); err != nil {
+		return fmt.Errorf("failed to save output: %w", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
 	}
 	return nil
 }
 
-func main() {
-	// Configure the logger
-	logutils.Configure(logutils.Configuration{IsJSONEnabled: false})
+// checkCopySize returns false if the output is larger than --max-copy-size and --force-copy is not set.
+// With --force-copy, a larger output is allowed with a warning.
+func checkCopySize(output string) bool {
+	if maxCopySizeBytes == 0 || uint64(len(output)) <= maxCopySizeBytes {
+		return true
+	}
+	if !forceCopy {
+		return false
+	}
+	slog.Warn("copying output larger than --max-copy-size",
+		slog.String("size", humanize.Bytes(uint64(len(output)))), slog.String("limit", humanize.Bytes(maxCopySizeBytes)))
+	return true
+}
+
+// generateHelpMessage generates the help message for the root command.
+func generateHelpMessage() (string, error) {
+	var b strings.Builder
+	b.WriteString(StyleBoldGreen.Render("grokker") + " is a command-line tool for grokking files " + StyleFaint.Render("(") + StyleFaintUnderline.Render("https://github.com/zaydek/grokker") + StyleFaint.Render(")") + "\n\n")
+	b.WriteString(StyleBoldWhite.Render("Usage: grokker [flags] [paths...]") + "\n\n")
+	b.WriteString(StyleBoldWhite.Render("Flags:") + "\n")
+	flagUsages := [][2]string{
+		{"--dir", "Directories or glob patterns to search (comma-separated, default [.])"},
+		{"--from-file", "File of newline-separated paths to process instead of searching directories, or - for stdin (default none)"},
+		{"--stdin", "Read newline-separated file paths from stdin instead of searching directories (default false)"},
+		{"-0, --null", "Separate the paths from --from-file or --stdin by NUL bytes instead of newlines (default false)"},
+		{"--strict", "Fail on unreadable files and directories, and on missing paths from --from-file or --stdin (default false)"},
+		{"--git-diff", "Only include files that differ from a git ref (default HEAD when set without a value)"},
+		{"--git-diff-untracked", "Also include untracked files with --git-diff (default false)"},
+		{"--dir-depth", "Maximum directory depth to search, 0 or 1 meaning only the top level (default -1, meaning infinite)"},
+		{"--ext", "File extensions to include with leading dot, or to exclude with a leading ! (comma-separated, default []). Example: .ts, !.lock"},
+		{"--substring", "Substrings to filter by (comma-separated, default [])"},
+		{"--path-substring", "Substrings to filter file paths by (comma-separated, default [])"},
+		{"--content-substring", "Substrings to filter file contents by (comma-separated, default [])"},
+		{"--regex", "Interpret --substring values as regular expressions (default false)"},
+		{"--exclude", "Substrings to exclude files by (comma-separated, default [])"},
+		{"--no-default-ignores", "Search directories that are ignored by default, such as node_modules (default false)"},
+		{"--show-ignored", "Print the directories skipped by the default ignore list (default false)"},
+		{"--include-hidden", "Include hidden files and directories (default false)"},
+		{"--follow-symlinks", "Follow symlinked files and directories, skipping cycles (default false)"},
+		{"--exclude-dir", "Directory names or relative paths to skip (comma-separated, default [])"},
+		{"--case-sensitive", "Match extensions and path substrings case-sensitively (default false)"},
+		{"--smart-case", "Match patterns case-sensitively only if they contain an uppercase letter (default false)"},
+		{"--binary-action", "Treatment of binary files: skip, placeholder, include (default skip)"},
+		{"--include-binary", "Include binary files as a hex dump, same as --binary-action=include (default false)"},
+		{"--redact", "Replace common secrets such as API keys with [REDACTED] in every file, not only .env files (default false)"},
+		{"--redact-pattern", "Regular expression of secrets to redact instead of the built-in patterns (repeatable, default none)"},
+		{"--modified-since", "Only include files modified within a duration (e.g. 24h, 7d) or since a date or RFC3339 time (default none)"},
+		{"--since", "Alias of --modified-since (default none)"},
+		{"--newer-than", "Alias of --modified-since (default none)"},
+		{"--before", "Only include files modified before a duration ago (e.g. 7d), a date, or an RFC3339 time (default none)"},
+		{"--older-than", "Alias of --before (default none)"},
+		{"--max-size", "Skip files larger than this size, e.g. 512KB (default unlimited)"},
+		{"--min-size", "Skip files smaller than this size, e.g. 1B (default none)"},
+		{"--max-file-size", "Maximum size of files to read, e.g. 100KB, 2MB (default unlimited)"},
+		{"--concurrency", "Number of files to read concurrently (default number of CPUs)"},
+		{"--tree-stats", "Show line counts and byte sizes in the tree format (default false)"},
+		{"--tree-style", "Tree style: auto, plain, unicode (default auto)"},
+		{"--tree-depth", "Maximum depth to expand in the tree format (default -1, meaning infinite)"},
+		{"--tree-readme-hints", "Annotate directories in the tree format with the first line of their README (default false)"},
+		{"--sort", "Order of files within each format: name, modified, size, ext, none (default name)"},
+		{"--reverse", "Reverse the --sort order (default false)"},
+		{"--sort-by", "Order of the per-file table in the stats format: name, size, lines, modtime (default the --sort order)"},
+		{"--truncate-lines", "Maximum bytes per line in the contents format (default 0, meaning unlimited)"},
+		{"--template", "Go template for each file in the contents format, e.g. '{{.Path}}:\\n{{.Content}}' (default none)"},
+		{"--template-file", "File to read the --template from (default none)"},
+		{"--markdown", "Emit the contents format as markdown with fenced code blocks (default false)"},
+		{"--file-header", "Header before each file in the contents format, with {path} and {ext} placeholders (default '# {path}\\n')"},
+		{"--file-footer", "Footer after each file in the contents format, with {path} and {ext} placeholders (default '\\n')"},
+		{"--header-template", "Go template for the header before each file in the contents format (default '# {{.Path}}')"},
+		{"--line-numbers", "Prefix each line in the contents format with its line number (default false)"},
+		{"--readme-first", "Emit README files first within each directory in the contents format (default false)"},
+		{"--order-from", "File listing paths in the order to emit them in the contents format (default none)"},
+		{"--contents-ordering", "Order of files in the contents format: walk, imports-first (default walk)"},
+		{"--list-tokens", "Show estimated tokens per file in the list format (default false)"},
+		{"--list-modtime", "Show the modification time of each file in the list format (default false)"},
+		{"--max-tokens", "Maximum estimated tokens of the output (default 0, meaning unlimited)"},
+		{"--truncate", "Drop the largest files until the output fits --max-tokens (default false)"},
+		{"--progressive-detail", "Reduce detail until the output fits --max-tokens (default false)"},
+		{"--max-files", "Confirm before processing more than this many files (default 50, 0 means never, -1 always)"},
+		{"--confirm-threshold", "Alias of --max-files (default 50)"},
+		{"--confirm-threshold-bytes", "Confirm before processing more than this many bytes, e.g. 1MB (default 1MB)"},
+		{"-y, --yes", "Skip the confirmation prompt (default false)"},
+		{"--no-confirm", "Alias of --yes (default false)"},
+		{"--sample", "Select N files at random from the matched files (default 0, meaning all)"},
+		{"--seed", "Random seed for --sample (default random)"},
+		{"--action", "Actions to perform: print, copy, save (comma-separated, default print,copy)"},
+		{"--clipboard", "Clipboard backend for the copy action: auto, native, osc52 (default auto)"},
+		{"--max-copy-size", "Largest output to copy to the clipboard, e.g. 2MB, or 0 for unlimited (default 10MB)"},
+		{"--force-copy", "Copy outputs larger than --max-copy-size anyway (default false)"},
+		{"--interactive", "Pick the files in a terminal picker before rendering (default false)"},
+		{"--watch", "Rerun whenever files change (default false)"},
+		{"-o, --output", "File to write the output to, or - for stdout (default none)"},
+		{"--split-by-root", "Write a separate --output file for each directory (default false)"},
+		{"--force", "Overwrite the --output file if it exists (default false)"},
+		{"--count-only", "Print only the number of matched files (default false)"},
+		{"--dry-run", "List and summarize the files that would be processed, without rendering or acting (default false)"},
+		{"--relative", "Emit paths relative to the current directory, keeping absolute paths outside of it (default false)"},
+		{"--format", "Output formats: tree, list, contents, summary, stats, matches, xml, signatures, paths0 (comma-separated, default tree,contents)"},
+		{"--route", "Formats to route to their own action, e.g. tree=print (repeatable, default none)"},
+		{"--format-separator", "Separator between formats, with escape sequences such as \\n (default \\n\\n)"},
+		{"-C, --context", "Lines of context around each matching line in the matches format (default 0)"},
+		{"--stats", "Summarize the files after the output: stderr, append (default stderr when set without a value)"},
+		{"--prefix", "Text to add before the output, with escape sequences such as \\n (default none)"},
+		{"--suffix", "Text to add after the output, with escape sequences such as \\n (default none)"},
+		{"--profile", "Named profile from the config file to apply (default none)"},
+		{"--no-config", "Skip loading the config file (default false)"},
+		{"--log-json", "Write logs as JSON (default false)"},
+		{"--log-level", "Minimum level of logs to write: debug, info, warn, error (default info)"},
+		{"--prompt", "Instructions to add to the output, with template fields such as {{.FileCount}} (default none)"},
+		{"--prompt-file", "File to read the --prompt text from (default none)"},
+		{"--prompt-position", "Where to place the prompt: start, end (default start)"},
+		{"--on-invalid-utf8", "Treatment of invalid UTF-8 in the output: error, replace, keep (default replace)"},
+	}
+	flagWidth := 0
+	for _, usage := range flagUsages {
+		flagWidth = max(flagWidth, len(usage[0]))
+	}
+	for _, usage := range flagUsages {
+		b.WriteString("  " + StyleCyan.Render(usage[0]) + strings.Repeat(" ", flagWidth-len(usage[0])+2) + usage[1] + "\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(StyleBoldWhite.Render("Examples:") + "\n")
+	b.WriteString("  " + StyleBlue.Render("grokker") + "                                                                                              " + StyleFaint.Render("Process all files in the current directory and print+copy the contents") + "\n")
+	b.WriteString("  " + StyleBlue.Render("grokker --substring=store --action=print --format=list") + "                                               " + StyleFaint.Render(`Print the list of files with "store" in the path`) + "\n")
+	b.WriteString("  " + StyleBlue.Render("grokker --dir=app --ext=.js --action=copy --format=contents") + "                                          " + StyleFaint.Render("Copy the contents of .js files in app/ to clipboard") + "\n")
+	b.WriteString("  " + StyleBlue.Render("grokker --dir=foo,bar --substring=bar,baz --ext=.ts,.tsx --action=print,copy --format=tree,contents") + "  " + StyleFaint.Render(`Print and copy the tree and contents of .ts/.tsx files with "bar" or "baz"`))
+	return b.String(), nil
+}
+
+// Entry represents a file collected while walking the directories.
+type Entry struct {
+	Path    string
+	RelPath string // Path relative to the directory it was found in
+	IsDir   bool
+	Depth   int
+	Size    int64
+	ModTime time.Time
+}
+
+// TemplateData is the data available to the --template for each file in the contents format.
+type TemplateData struct {
+	Path    string // Path of the file, e.g. app/store.js
+	RelPath string // Path relative to the directory it was found in, e.g. store.js
+	Ext     string // Extension with the leading dot, e.g. .js
+	Content string // Contents after --truncate-lines and --line-numbers
+	Lines   int    // Number of lines in the file
+	Bytes   int    // Size of the file in bytes
+}
+
+// HeaderData is the data available to the --header-template for each file in the contents format.
+type HeaderData struct {
+	Path    string // Path of the file, e.g. app/store.js
+	RelPath string // Path relative to the directory it was found in, e.g. store.js
+	Ext     string // Extension with the leading dot, e.g. .js
+	Lines   int    // Number of lines in the file, or 0 if it was not read
+	Bytes   int64  // Size of the file in bytes
+}
+
+// renderFormats generates the output for each format and joins them into a single string.
+// It returns the context's error if ctx is cancelled while reading files.
+func renderFormats(ctx context.Context, entriesByRoot map[string][]Entry, parsedFormats []Format, parsedTreeStyle TreeStyle) (string, error) {
+	var b strings.Builder
+	if err := writeFormats(ctx, &b, entriesByRoot, parsedFormats, parsedTreeStyle); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writeFormats writes the output for each format to w, separated by --format-separator.
+// Formats are written as they are rendered, and files are read in batches of readBatchSize,
+// so the contents of a large tree are never held in memory at once.
+// It returns the context's error if ctx is cancelled while reading files, or the first error writing to w.
+func writeFormats(ctx context.Context, w io.Writer, entriesByRoot map[string][]Entry, parsedFormats []Format, parsedTreeStyle TreeStyle) error {
+	ew := &errWriter{w: w}
+	for i, format := range parsedFormats {
+		if i > 0 {
+			io.WriteString(ew, parsedFormatSeparator)
+		}
+		// Paths may contain any whitespace, so the paths0 format is never normalized
+		var fw io.Writer = ew
+		if format != FormatPaths0 {
+			fw = &newlineNormalizer{w: ew}
+		}
+		var output string
+		switch format {
+		case FormatContents:
+			contentEntries := flattenEntries(entriesByRoot)
+			sortEntries(contentEntries, parsedSortOrder)
+			if parsedContentsOrdering == ContentsOrderingImportsFirst {
+				contentEntries = orderImportsFirst(ctx, contentEntries)
+			}
+			if readmeFirst {
+				contentEntries = floatReadmes(contentEntries)
+			}
+			if orderFrom != "" {
+				contentEntries = orderFromManifest(contentEntries, orderFromPaths)
+			}
+			for start := 0; start < len(contentEntries); start += readBatchSize {
+				batch := contentEntries[start:min(start+readBatchSize, len(contentEntries))]
+				contentFiles := readFiles(ctx, batch)
+				for i, entry := range batch {
+					// Skip files that exceed --max-file-size
+					if contentFiles[i].TooLarge {
+						io.WriteString(fw, formatFileBlock(entry, nil, "[skipped: exceeds max-file-size]"))
+						continue
+					}
+					content, err := contentFiles[i].Content, contentFiles[i].Err
+					if err != nil {
+						slog.Debug("skipped unreadable file", slog.String("path", entry.Path), slog.String("error", err.Error()))
+						continue
+					}
+					contentStr := string(content)
+					if isBinary(content) {
+						switch parsedBinaryAction {
+						case BinaryActionPlaceholder:
+							io.WriteString(fw, formatFileBlock(entry, content, "[binary file: "+entry.Path+"]"))
+							continue
+						case BinaryActionInclude:
+							contentStr = hex.Dump(content)
+						default:
+							slog.Debug("skipped binary file", slog.String("path", entry.Path))
+							continue
+						}
+					} else {
+						contentStr = redactContent(entry.Path, contentStr)
+					}
+					if truncateLinesBytes > 0 {
+						contentStr = truncateLines(contentStr, truncateLinesBytes)
+					}
+					if lineNumbers {
+						// Numbered blank lines are not collapsed by the newline normalization
+						contentStr = numberLines(contentStr)
+					}
+					if headTailLines > 0 {
+						contentStr = trimHeadTail(contentStr, headTailLines)
+					}
+					if markdown {
+						contentStr = fenceCodeBlock(contentStr, strings.TrimPrefix(filepath.Ext(entry.Path), "."))
+					}
+					if parsedTemplate != nil {
+						data := TemplateData{Path: entry.Path, RelPath: entry.RelPath, Ext: filepath.Ext(entry.Path), Content: contentStr, Lines: countLines(content), Bytes: len(content)}
+						if err := parsedTemplate.Execute(fw, data); err != nil {
+							return fmt.Errorf("failed to execute template for %s: %w", entry.Path, err)
+						}
+						continue
+					}
+					io.WriteString(fw, formatFileBlock(entry, content, contentStr))
+				}
+			}
+
+		case FormatSummary:
+			var rows [][]string
+			var totalLines int
+			var totalBytes, totalTokens int64
+			var skippedBytes, skippedTokens int64
+			summaryEntries := flattenEntries(entriesByRoot)
+			sortEntries(summaryEntries, parsedSortOrder)
+			for start := 0; start < len(summaryEntries); start += readBatchSize {
+				batch := summaryEntries[start:min(start+readBatchSize, len(summaryEntries))]
+				summaryFiles := readFiles(ctx, batch)
+				for i, entry := range batch {
+					// Files that exceed --max-file-size are listed, but left out of the total since they are not emitted
+					if summaryFiles[i].TooLarge {
+						rows = append(rows, []string{entry.Path, "-", humanize.Comma(entry.Size), humanize.Comma(estimateTokens(entry.Size))})
+						skippedBytes += entry.Size
+						skippedTokens += estimateTokens(entry.Size)
+						continue
+					}
+					content, err := summaryFiles[i].Content, summaryFiles[i].Err
+					if err != nil {
+						slog.Debug("skipped unreadable file", slog.String("path", entry.Path), slog.String("error", err.Error()))
+						continue
+					}
+					lines := countLines(content)
+					tokens := int64(tokenizer.CountTokens(string(content)))
+					rows = append(rows, []string{entry.Path, humanize.Comma(int64(lines)), humanize.Comma(int64(len(content))), humanize.Comma(tokens)})
+					totalLines += lines
+					totalBytes += int64(len(content))
+					totalTokens += tokens
+				}
+			}
+			// Report the skipped files on their own row, so the total is exactly what the other formats emit
+			if skippedBytes > 0 {
+				rows = append(rows, []string{"skipped", "-", humanize.Comma(skippedBytes), humanize.Comma(skippedTokens)})
+			}
+			rows = append(rows, []string{"total", humanize.Comma(int64(totalLines)), humanize.Comma(totalBytes), humanize.Comma(totalTokens)})
+			output = renderTable([]string{"path", "lines", "bytes", "tokens"}, rows)
+
+		case FormatSignatures:
+			signatureEntries := flattenEntries(entriesByRoot)
+			sortEntries(signatureEntries, parsedSortOrder)
+			for start := 0; start < len(signatureEntries); start += readBatchSize {
+				batch := signatureEntries[start:min(start+readBatchSize, len(signatureEntries))]
+				signatureFiles := readFiles(ctx, batch)
+				for i, entry := range batch {
+					// Skip files that exceed --max-file-size
+					if signatureFiles[i].TooLarge {
+						io.WriteString(fw, formatFileBlock(entry, nil, "[skipped: exceeds max-file-size]"))
+						continue
+					}
+					content, err := signatureFiles[i].Content, signatureFiles[i].Err
+					if err != nil {
+						slog.Debug("skipped unreadable file", slog.String("path", entry.Path), slog.String("error", err.Error()))
+						continue
+					}
+					if isBinary(content) {
+						slog.Debug("skipped binary file", slog.String("path", entry.Path))
+						continue
+					}
+					io.WriteString(fw, formatFileBlock(entry, content, redactContent(entry.Path, goSignatures(entry.Path, content))))
+				}
+			}
+
+		case FormatXML:
+			var err error
+			output, err = renderXML(ctx, entriesByRoot)
+			if err != nil {
+				return err
+			}
+
+		case FormatList:
+			filteredEntries := flattenEntries(entriesByRoot)
+			sortEntries(filteredEntries, parsedSortOrder)
+			if listTokens || listModTime {
+				var rows [][]string
+				for _, entry := range filteredEntries {
+					row := []string{entry.Path}
+					if listModTime {
+						row = append(row, entry.ModTime.Format("2006-01-02 15:04"))
+					}
+					if listTokens {
+						row = append(row, humanize.Comma(estimateTokens(entry.Size))+" tokens")
+					}
+					rows = append(rows, row)
+				}
+				output = renderTable(nil, rows)
+			} else {
+				var filteredFiles []string
+				for _, entry := range filteredEntries {
+					filteredFiles = append(filteredFiles, entry.Path)
+				}
+				output = strings.Join(filteredFiles, "\n")
+			}
+
+		case FormatStats:
+			output = renderStats(ctx, entriesByRoot, true)
+
+		case FormatMatches:
+			output = renderMatches(ctx, entriesByRoot)
+
+		case FormatPaths0:
+			// Terminate each path with NUL, like find -print0, so paths with spaces or newlines survive xargs -0
+			paths0Entries := flattenEntries(entriesByRoot)
+			sortEntries(paths0Entries, parsedSortOrder)
+			for _, entry := range paths0Entries {
+				io.WriteString(fw, entry.Path+"\x00")
+			}
+
+		case FormatTree:
+			var b strings.Builder
+			for _, root := range sortedRoots(entriesByRoot) {
+				entries := entriesByRoot[root]
+				rootNode := &TreeNode{IsDir: true, Children: make(map[string]*TreeNode)}
+				leaves := make([]*TreeNode, len(entries))
+				for i, entry := range entries {
+					relPath, err := filepath.Rel(root, entry.Path)
+					if err != nil {
+						return fmt.Errorf("failed to get relative path: %w", err)
+					}
+					parts := strings.Split(relPath, string(os.PathSeparator))
+					leaf := Insert(rootNode, parts, entry.IsDir)
+					leaf.Bytes = entry.Size
+					leaf.ModTime = entry.ModTime
+					leaf.Lines = -1
+					if maxFileSizeBytes > 0 && uint64(entry.Size) > maxFileSizeBytes {
+						leaf.Hint = "skipped: exceeds max-file-size"
+					}
+					leaves[i] = leaf
+				}
+				// Count lines for --tree-stats, reading the files in batches like the other formats
+				if treeStats {
+					for start := 0; start < len(entries); start += readBatchSize {
+						batch := entries[start:min(start+readBatchSize, len(entries))]
+						treeFiles := readFiles(ctx, batch)
+						for i, entry := range batch {
+							if treeFiles[i].TooLarge {
+								continue
+							}
+							if treeFiles[i].Err != nil {
+								slog.Debug("skipped unreadable file", slog.String("path", entry.Path), slog.String("error", treeFiles[i].Err.Error()))
+								continue
+							}
+							leaves[start+i].Lines = countLines(treeFiles[i].Content)
+						}
+					}
+				}
+				if len(entries) > 0 {
+					var stats string
+					if treeStats {
+						stats = formatStats(rootNode)
+					}
+					if treeReadmeHints {
+						annotateReadmeHints(rootNode, root)
+					}
+					if treeDepth == 0 {
+						b.WriteString(strings.TrimSuffix(root, "/") + "/" + formatCollapsed(rootNode) + stats + formatHint(rootNode) + "\n")
+						continue
+					}
+					b.WriteString(strings.TrimSuffix(root, "/") + "/" + stats + formatHint(rootNode) + "\n")
+					indent := "  "
+					if parsedTreeStyle == TreeStyleUnicode {
+						indent = ""
+					}
+					b.WriteString(Print(rootNode, indent, PrintOptions{Style: parsedTreeStyle, Sort: parsedSortOrder, Reverse: reverseSort, ShowStats: treeStats, MaxDepth: treeDepth}))
+				}
+			}
+			output = b.String()
+
+		default:
+			slog.Error("internal error")
+			continue
+		}
+		io.WriteString(fw, output)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if ew.err != nil {
+			return fmt.Errorf("failed to write output: %w", ew.err)
+		}
+	}
+	return nil
+}
+
+// flagAliases maps alternative flag names to the flags they stand for (e.g., --since for --modified-since).
+var flagAliases = map[string]string{
+	"since":             "modified-since",
+	"confirm-threshold": "max-files",
+	"no-confirm":        "yes",
+	"newer-than":        "modified-since",
+	"older-than":        "before",
+	"output-file":       "output",
+}
+
+// normalizeFlagName resolves flag aliases, so an alias is accepted anywhere its flag is, including the config file.
+func normalizeFlagName(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if flag, ok := flagAliases[name]; ok {
+		name = flag
+	}
+	return pflag.NormalizedName(name)
+}
+
+// Root command definition
+var rootCmd = &cobra.Command{
+	Use:   "grokker [paths...]",
+	Short: "grokker: Process files for AI prompting",
+	Long: `grokker is a command-line tool designed to process files in specified directories for AI prompting.
+It formats file paths and contents, optionally filters by substrings and extensions,
+and performs specified actions on the output generated in the specified formats.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Print the help message if no arguments are provided
+		if len(os.Args) == 1 {
+			help, _ := generateHelpMessage()
+			fmt.Println(help)
+			os.Exit(0)
+		}
+
+		// Rerun whenever files change (--watch)
+		if watch {
+			return runWatch(cmd.Context(), cmd)
+		}
+		return run(cmd.Context(), cmd)
+	},
+}
+
+// errCancelled returns the error reported when a run is cancelled (e.g., on SIGINT) after collecting the given number of files.
+func errCancelled(files int) error {
+	return fmt.Errorf("cancelled after %s files", humanize.Comma(int64(files)))
+}
+
+// run collects, formats, and acts on the files according to the command-line flags.
+// If ctx is cancelled before the actions run, it stops and returns an error without performing them.
+func run(ctx context.Context, cmd *cobra.Command) error {
+	// Parse the actions
+	var parsedActions []Action
+	for _, actionStr := range actions {
+		action, _ := parseAction(actionStr)
+		parsedActions = append(parsedActions, action)
+	}
+
+	// Parse the formats
+	var parsedFormats []Format
+	for _, formatStr := range formats {
+		format, _ := parseFormat(formatStr)
+		parsedFormats = append(parsedFormats, format)
+	}
+
+	// Route each format to its own actions (--route)
+	if len(parsedRoutes) > 0 {
+		parsedFormats = routedFormats(parsedRoutes)
+		parsedActions = routedActions(parsedRoutes)
+	}
+
+	// Parse the tree style
+	parsedTreeStyle, _ := parseTreeStyle(treeStyle)
+
+	// Collect files with depth control and extension filter, from a list of paths (--from-file, --stdin) or by walking the directories
+	var entriesByRoot map[string][]Entry
+	var walkStats WalkStats
+	var err error
+	if fromFile != "" {
+		entriesByRoot, err = readPathEntriesFrom(fromFile)
+	} else {
+		entriesByRoot, walkStats, err = walkEntries(ctx)
+	}
+	if ctx.Err() != nil {
+		return errCancelled(walkStats.Files)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Emit paths relative to the working directory (--relative), keeping absolute paths for files outside of it
+	if relative {
+		entriesByRoot, err = relativizeEntries(entriesByRoot)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Limit the files to those that differ from a git ref (--git-diff), before any contents are read
+	if gitDiff != "" {
+		changed, err := gitChangedPaths(gitDiff, gitDiffUntracked)
+		if err != nil {
+			return err
+		}
+		for root, entries := range entriesByRoot {
+			var kept []Entry
+			for _, entry := range entries {
+				if isGitChanged(changed, entry.Path) {
+					kept = append(kept, entry)
+				}
+			}
+			entriesByRoot[root] = kept
+		}
+	}
+
+	// Print the directories skipped by the default ignore list (--show-ignored)
+	if showIgnored {
+		fmt.Fprintln(os.Stderr, StyleBoldRed.Render(fmt.Sprintf("Ignored %s directories:", humanize.Comma(int64(len(walkStats.IgnoredDirs))))))
+		for _, dir := range walkStats.IgnoredDirs {
+			fmt.Fprintln(os.Stderr, "  "+dir)
+		}
+	}
+
+	// Report the number of files skipped by size (--max-size, --min-size), here and in the stats format
+	lastWalkStats = walkStats
+	unreadableFiles = make(map[string]error)
+	if walkStats.TooLarge > 0 {
+		fmt.Fprintln(os.Stderr, StyleFaint.Render(fmt.Sprintf("Skipped %s files over %s", humanize.Comma(int64(walkStats.TooLarge)), humanize.Bytes(maxSizeBytes))))
+	}
+	if walkStats.TooSmall > 0 {
+		fmt.Fprintln(os.Stderr, StyleFaint.Render(fmt.Sprintf("Skipped %s files under %s", humanize.Comma(int64(walkStats.TooSmall)), humanize.Bytes(minSizeBytes))))
+	}
+
+	// Filter files by --path-substring before reading anything, since it only needs the paths
+	if len(pathSubstrings) > 0 {
+		for root, entries := range entriesByRoot {
+			var kept []Entry
+			for _, entry := range entries {
+				if isPathIncluded(entry.Path) {
+					kept = append(kept, entry)
+				}
+			}
+			entriesByRoot[root] = kept
+		}
+	}
+
+	// Filter files by --substring, --content-substring, and --exclude once, so every format renders the same files.
+	// Files are read in batches of readBatchSize and their contents are not kept, so memory stays bounded on large trees
+	// and streamed output stays streamed; the formats read the kept files again. Exclusion wins over inclusion.
+	if len(substrings) > 0 || len(contentSubstrings) > 0 || len(excludes) > 0 {
+		for root, entries := range entriesByRoot {
+			var kept []Entry
+			for start := 0; start < len(entries); start += readBatchSize {
+				batch := entries[start:min(start+readBatchSize, len(entries))]
+				files := readFiles(ctx, batch)
+				if ctx.Err() != nil {
+					return errCancelled(len(entries))
+				}
+				for i, entry := range batch {
+					if files[i].Err != nil {
+						slog.Debug("skipped unreadable file", slog.String("path", entry.Path), slog.String("error", files[i].Err.Error()))
+						continue
+					}
+					content := string(files[i].Content)
+					if !isIncluded(entry.Path, content) || len(excludes) > 0 && anySubstringMatches(excludes, entry.Path, content) {
+						continue
+					}
+					kept = append(kept, entry)
+				}
+			}
+			entriesByRoot[root] = kept
+		}
+	}
+
+	// Select a random sample of files (--sample), preserving walk order within each root
+	if sample > 0 {
+		candidates := flattenEntries(entriesByRoot)
+		if sample < len(candidates) {
+			if !cmd.Flags().Changed("seed") {
+				seed = rand.Int64()
+			}
+			rng := rand.New(rand.NewPCG(uint64(seed), 0))
+			selected := make(map[string]bool)
+			for _, i := range rng.Perm(len(candidates))[:sample] {
+				selected[candidates[i].Path] = true
+			}
+			for root, entries := range entriesByRoot {
+				var sampled []Entry
+				for _, entry := range entries {
+					if selected[entry.Path] {
+						sampled = append(sampled, entry)
+					}
+				}
+				entriesByRoot[root] = sampled
+			}
+		}
+	}
+
+	// Pick the files by hand (--interactive); aborting the picker ends the run without doing anything
+	if interactive {
+		picked, err := pickEntries(ctx, entriesByRoot)
+		if ctx.Err() != nil {
+			return errCancelled(Count(NewTree(flattenEntries(entriesByRoot))))
+		}
+		if errors.Is(err, errPickerAborted) {
+			fmt.Println("Aborted.")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entriesByRoot = picked
+	}
+
+	// Warn about paths listed in --order-from that did not match any file
+	tree := NewTree(flattenEntries(entriesByRoot))
+	if orderFrom != "" {
+		matched := make(map[string]bool)
+		for _, path := range Paths(tree, "") {
+			matched[path] = true
+		}
+		for _, path := range orderFromPaths {
+			if !matched[path] {
+				slog.Warn("path in order-from file did not match any file", slog.String("path", path))
+			}
+		}
+	}
+
+	// Print only the number of matched files (--count-only), without rendering any format or prompting
+	if countOnly {
+		fmt.Println(Count(tree))
+		return nil
+	}
+
+	// List and summarize the files instead of rendering formats and performing actions (--dry-run).
+	// The paths go to stdout, one per line, so they can be piped; the summary goes to stderr.
+	if dryRun {
+		dryRunEntries := flattenEntries(entriesByRoot)
+		sortEntries(dryRunEntries, parsedSortOrder)
+		for _, entry := range dryRunEntries {
+			fmt.Println(entry.Path)
+		}
+		fmt.Fprint(os.Stderr, "\n"+renderDryRun(entriesByRoot))
+		return nil
+	}
+
+	// Ensure there are files to process, except for the xml format alone, which renders an empty <files></files> document
+	// so tools parsing the output do not need to handle a plain-text message
+	totalFiles := Count(tree)
+	if totalFiles == 0 && !slices.Equal(parsedFormats, []Format{FormatXML}) {
+		fmt.Println("No files found.")
+		return nil
+	}
+
+	// Confirm before processing a large number of files (--max-files) or bytes (--confirm-threshold-bytes);
+	// --max-files=0 turns off both triggers
+	_, totalBytes := Stats(tree)
+	if !yes && !interactive && maxFiles != 0 && (maxFiles == -1 || totalFiles > maxFiles || confirmThresholdBytes > 0 && uint64(totalBytes) > confirmThresholdBytes) {
+		// Never block on a prompt that nobody can answer (CI, git hooks, piped input)
+		if !isTerminal(os.Stdin) {
+			return fmt.Errorf("confirmation required to process %s files, %s, but stdin is not a terminal; pass --yes to proceed", humanize.Comma(int64(totalFiles)), humanize.Bytes(uint64(totalBytes)))
+		}
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Println(StyleBoldRed.Render(fmt.Sprintf("WARNING: Processing %s files, %s (~%s tokens). Proceed? [y/N] ", humanize.Comma(int64(totalFiles)), humanize.Bytes(uint64(totalBytes)), humanize.Comma(estimateTokens(totalBytes)))))
+		// Read the response in the background, so a signal can interrupt the prompt
+		responses := make(chan string, 1)
+		go func() {
+			response, _ := reader.ReadString('\n')
+			responses <- response
+		}()
+		var response string
+		select {
+		case <-ctx.Done():
+			return errCancelled(totalFiles)
+		case response = <-responses:
+		}
+		if !strings.EqualFold(strings.TrimSpace(response), "y") {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+
+	// Stream the output to stdout and --output as it is rendered, unless something needs the whole output at once
+	if canStream(parsedActions) {
+		totalTokens, err := streamOutput(ctx, entriesByRoot, parsedActions, parsedFormats, parsedTreeStyle)
+		if ctx.Err() != nil {
+			return errCancelled(totalFiles)
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkUnreadableFiles(); err != nil {
+			return err
+		}
+		if parsedStatsMode == StatsStderr {
+			fmt.Fprintln(os.Stderr, renderStats(ctx, entriesByRoot, false))
+		}
+		printSkippedPaths()
+		if parsedStatsMode == StatsStderr {
+			fmt.Fprintln(os.Stderr, StyleFaint.Render(fmt.Sprintf("~%s tokens", humanize.Comma(totalTokens))))
+		}
+		return nil
+	}
+
+	// Process the files, failing before any action with --strict if some could not be read
+	combinedOutput, err := renderFormats(ctx, entriesByRoot, parsedFormats, parsedTreeStyle)
+	if ctx.Err() != nil {
+		return errCancelled(totalFiles)
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkUnreadableFiles(); err != nil {
+		return err
+	}
+
+	// Enforce the token budget (--max-tokens), reducing detail with --progressive-detail or dropping the largest files first with --truncate
+	totalTokens := tokenizer.CountTokens(combinedOutput)
+	if maxTokens > 0 && totalTokens > maxTokens {
+		if progressiveDetail {
+			var level DetailLevel
+			combinedOutput, level, err = renderProgressiveDetail(ctx, entriesByRoot, parsedFormats, parsedTreeStyle, maxTokens)
+			if ctx.Err() != nil {
+				return errCancelled(totalFiles)
+			}
+			if err != nil {
+				return err
+			}
+			totalTokens = tokenizer.CountTokens(combinedOutput)
+			fmt.Fprintln(os.Stderr, StyleBoldRed.Render(fmt.Sprintf("Reduced detail to %s to fit max tokens", level.Name)))
+		} else if !truncate {
+			return fmt.Errorf("output exceeds max tokens by ~%s tokens (~%s > %s); pass --truncate to drop the largest files", humanize.Comma(int64(totalTokens-maxTokens)), humanize.Comma(int64(totalTokens)), humanize.Comma(int64(maxTokens)))
+		} else {
+			var omitted []Entry
+			combinedOutput, omitted, err = fitToTokenBudget(ctx, entriesByRoot, parsedFormats, parsedTreeStyle, maxTokens)
+			if ctx.Err() != nil {
+				return errCancelled(totalFiles)
+			}
+			if err != nil {
+				return err
+			}
+			totalTokens = tokenizer.CountTokens(combinedOutput)
+			fmt.Fprintln(os.Stderr, StyleBoldRed.Render(fmt.Sprintf("Omitted %s files to fit max tokens:", humanize.Comma(int64(len(omitted))))))
+			for _, entry := range omitted {
+				fmt.Fprintln(os.Stderr, "  "+entry.Path)
+			}
+			entriesByRoot = omitEntries(entriesByRoot, omitted)
+		}
+	}
+
+	// Append the summary of the files (--stats=append) to the output they ended up in, and wrap it (--prefix, --suffix)
+	combinedOutput = parsedPrefix + appendStats(ctx, combinedOutput, entriesByRoot) + parsedSuffix
+	totalTokens = tokenizer.CountTokens(combinedOutput)
+
+	// Ensure the output is valid UTF-8 (--on-invalid-utf8)
+	combinedOutput, err = ensureValidUTF8(combinedOutput)
+	if err != nil {
+		return err
+	}
+
+	// Render the prompt (--prompt, --prompt-file) once, so every action and --output get the same text
+	var prompt string
+	if parsedPrompt != nil {
+		tree, err := renderFormats(ctx, entriesByRoot, []Format{FormatTree}, parsedTreeStyle)
+		if err != nil {
+			return err
+		}
+		data := PromptData{FileCount: Count(NewTree(flattenEntries(entriesByRoot))), TotalTokens: totalTokens, Tree: tree}
+		var b strings.Builder
+		if err := parsedPrompt.Execute(&b, data); err != nil {
+			return fmt.Errorf("failed to execute prompt template: %w", err)
+		}
+		prompt = b.String()
+		combinedOutput = applyPrompt(prompt, combinedOutput)
+		totalTokens = tokenizer.CountTokens(combinedOutput)
+	}
+
+	// Perform the specified actions, each on the output of the formats routed to it (--route)
+	for _, action := range parsedActions {
+		actionOutput := combinedOutput
+		if len(parsedRoutes) > 0 {
+			actionOutput, err = renderFormats(ctx, entriesByRoot, formatsRoutedTo(parsedRoutes, action), parsedTreeStyle)
+			if err != nil {
+				return err
+			}
+			actionOutput = parsedPrefix + appendStats(ctx, actionOutput, entriesByRoot) + parsedSuffix
+			actionOutput, err = ensureValidUTF8(actionOutput)
+			if err != nil {
+				return err
+			}
+			actionOutput = applyPrompt(prompt, actionOutput)
+		}
+		switch action {
+		case ActionPrint:
+			// Do not add a newline after NUL-terminated paths (--format=paths0), which xargs -0 would read as a path
+			if strings.HasSuffix(actionOutput, "\x00") {
+				fmt.Print(actionOutput)
+			} else {
+				fmt.Println(actionOutput)
+			}
+		case ActionCopy:
+			// Refuse outputs over --max-copy-size, but keep going so the other actions (such as print) still run
+			if !checkCopySize(actionOutput) {
+				fmt.Fprintln(os.Stderr, StyleBoldRed.Render(fmt.Sprintf("Refused to copy %s to the clipboard (over --max-copy-size of %s)", humanize.Bytes(uint64(len(actionOutput))), humanize.Bytes(maxCopySizeBytes))))
+				fmt.Fprintln(os.Stderr, StyleFaint.Render("Write it to a file with --output, narrow it with --format or --ext, or pass --force-copy to copy it anyway"))
+				continue
+			}
+			if err := copyToClipboard([]byte(actionOutput)); err != nil {
+				slog.Error("failed to copy", slog.String("error", err.Error()))
+			}
+		case ActionSave:
+			if err := saveOutput(output, actionOutput, force); err != nil {
+				return err
+			}
+		default:
+			slog.Error("internal error")
+		}
+	}
+
+	// Write the output to a file per root (--split-by-root), with the same prompt and UTF-8 treatment as the combined output
+	if output != "" && splitByRoot {
+		used := make(map[string]bool)
+		for _, root := range sortedRoots(entriesByRoot) {
+			if len(entriesByRoot[root]) == 0 {
+				continue
+			}
+			rootOutput, err := renderFormats(ctx, map[string][]Entry{root: entriesByRoot[root]}, parsedFormats, parsedTreeStyle)
+			if err != nil {
+				return err
+			}
+			rootOutput = parsedPrefix + appendStats(ctx, rootOutput, map[string][]Entry{root: entriesByRoot[root]}) + parsedSuffix
+			rootOutput, err = ensureValidUTF8(rootOutput)
+			if err != nil {
+				return err
+			}
+			data := applyPrompt(prompt, rootOutput)
+			if !strings.HasSuffix(data, "\x00") {
+				data += "\n"
+			}
+			if err := writeOutput(splitOutputPath(output, root, used), []byte(data), force); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Write the output to a file (--output), unless the save action already did
+	if output != "" && !splitByRoot && !slices.Contains(parsedActions, ActionSave) {
+		data := combinedOutput
+		if !strings.HasSuffix(data, "\x00") {
+			data += "\n"
+		}
+		if err := writeOutput(output, []byte(data), force); err != nil {
+			return err
+		}
+	}
+	if parsedStatsMode == StatsStderr {
+		fmt.Fprintln(os.Stderr, renderStats(ctx, entriesByRoot, false))
+	}
+	printSkippedPaths()
+	// Report the estimated tokens of the whole output only with --stats, so piped runs keep stderr quiet
+	if parsedStatsMode == StatsStderr {
+		fmt.Fprintln(os.Stderr, StyleFaint.Render(fmt.Sprintf("~%s tokens", humanize.Comma(int64(totalTokens)))))
+	}
+	return nil
+}
+
+// PreRunE validates the command-line flags before the main command executes.
+func PreRunE(cmd *cobra.Command, args []string) error {
+	// Validate the flags --log-json and --log-level, and configure the logger before anything is logged
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+		return fmt.Errorf("log level is invalid: %s", logLevel)
+	}
+	logutils.Configure(logutils.Configuration{IsJSONEnabled: logJSON, Level: level})
+
+	// Expand the flag --dir (replace ~ with the user's home directory)
+	var expandedDirs []string
+	for _, dir := range dirs {
+		expanded, err := expandTilde(dir)
+		if err != nil {
+			return err
+		}
+		expandedDirs = append(expandedDirs, expanded)
+	}
+	dirs = expandedDirs
+
+	// Expand glob patterns in the flag --dir (e.g., apps/*/src or src/**/components)
+	var globbedDirs []string
+	for _, dir := range dirs {
+		if !hasGlobMeta(dir) {
+			globbedDirs = append(globbedDirs, dir)
+			continue
+		}
+		matches, err := globDirs(dir)
+		if err != nil {
+			return fmt.Errorf("directory pattern is invalid: %s", dir)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("directory pattern matches no directories: %s", dir)
+		}
+		globbedDirs = append(globbedDirs, matches...)
+	}
+	dirs = globbedDirs
+
+	// Validate the flags --stdin and --from-file (--stdin is short for --from-file=-)
+	if readStdin {
+		if fromFile != "" && fromFile != "-" {
+			return fmt.Errorf("stdin cannot be combined with --from-file=%s", fromFile)
+		}
+		fromFile = "-"
+	}
+	if fromFile != "" && fromFile != "-" {
+		expanded, err := expandTilde(fromFile)
+		if err != nil {
+			return err
+		}
+		fromFile = expanded
+		if info, err := os.Stat(fromFile); err != nil || info.IsDir() {
+			return fmt.Errorf("from-file is invalid: %s", fromFile)
+		}
+	}
+	if fromFile == "-" && watch {
+		return fmt.Errorf("stdin cannot be combined with --watch")
+	}
+
+	// Validate the flag --interactive, which needs a terminal for input and for drawing the picker
+	if interactive {
+		if watch {
+			return fmt.Errorf("interactive cannot be combined with --watch")
+		}
+		if !isTerminal(os.Stdin) || !isTerminal(os.Stderr) {
+			return fmt.Errorf("interactive requires a terminal; drop --interactive to run without the picker")
+		}
+	}
+
+	// Treat positional arguments as paths: directories are searched like --dir, and files are included directly
+	argFiles = nil
+	if len(args) > 0 {
+		if fromFile != "" {
+			return fmt.Errorf("positional paths cannot be combined with --from-file or --stdin")
+		}
+		var argDirs, invalidPaths []string
+		for _, arg := range args {
+			path, err := expandTilde(arg)
+			if err != nil {
+				return err
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				invalidPaths = append(invalidPaths, arg)
+				continue
+			}
+			if info.IsDir() {
+				argDirs = append(argDirs, path)
+			} else {
+				argFiles = append(argFiles, path)
+			}
+		}
+		if len(invalidPaths) > 0 {
+			return fmt.Errorf("paths are invalid: %s", strings.Join(invalidPaths, ", "))
+		}
+		// Positional paths replace the default --dir=., but add to directories passed explicitly
+		if cmd.Flags().Changed("dir") {
+			for _, dir := range argDirs {
+				if !slices.Contains(dirs, dir) {
+					dirs = append(dirs, dir)
+				}
+			}
+		} else {
+			dirs = argDirs
+		}
+	}
+
+	// Validate the flag --dir
+	var invalidDirs []string
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			invalidDirs = append(invalidDirs, dir)
+		}
+	}
+	if len(invalidDirs) > 0 {
+		return fmt.Errorf("directories are invalid: %s", strings.Join(invalidDirs, ", "))
+	}
+
+	// Validate the flag --git-diff-untracked
+	if gitDiffUntracked && gitDiff == "" {
+		return fmt.Errorf("git-diff-untracked requires --git-diff")
+	}
+
+	// Validate the flag --dir-depth
+	if dirDepth < -1 {
+		return fmt.Errorf("directory depth is invalid: %d (files directly in the directory are at depth 1)", dirDepth)
+	}
+
+	// Validate the flag --ext (ensure all extensions start with a dot), splitting negated extensions (e.g., !.lock) from the others
+	includedExts, excludedExts = nil, nil
+	for _, ext := range exts {
+		if negated, ok := strings.CutPrefix(ext, "!"); ok {
+			if !strings.HasPrefix(negated, ".") {
+				return fmt.Errorf("negated extensions must start with a dot (e.g., !.lock): %s", ext)
+			}
+			excludedExts = append(excludedExts, negated)
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("extensions must start with a dot (e.g., .ts): %s", ext)
+		}
+		includedExts = append(includedExts, ext)
+	}
+
+	// Validate the flag --smart-case
+	if smartCase && caseSensitive {
+		return fmt.Errorf("smart-case cannot be combined with --case-sensitive")
+	}
+
+	// Validate the flags --substring, --path-substring, and --content-substring as regular expressions (--regex)
+	if useRegex {
+		var err error
+		if substringRegexes, err = compileRegexes(substrings); err != nil {
+			return err
+		}
+		if pathSubstringRegexes, err = compileRegexes(pathSubstrings); err != nil {
+			return err
+		}
+		if contentRegexes, err = compileRegexes(contentSubstrings); err != nil {
+			return err
+		}
+	}
+
+	// Validate the flags --redact and --redact-pattern
+	patterns := defaultRedactPatterns
+	if len(redactPatterns) > 0 {
+		patterns = redactPatterns
+	}
+	parsedRedactRegexes = nil
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("redact pattern is invalid: %s: %w", pattern, err)
+		}
+		parsedRedactRegexes = append(parsedRedactRegexes, re)
+	}
+	redactAllFiles = redact || len(redactPatterns) > 0
+	redactEnvFiles = redactAllFiles || !cmd.Flags().Changed("redact")
+
+	// Validate the flag --exclude-dir
+	for _, pattern := range excludeDirs {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("excluded directory pattern is invalid: %s", pattern)
+		}
+	}
+
+	// Validate the flag --max-file-size
+	maxFileSizeBytes = 0
+	if maxFileSize != "" {
+		size, err := humanize.ParseBytes(maxFileSize)
+		if err != nil {
+			return fmt.Errorf("max file size is invalid: %s", maxFileSize)
+		}
+		maxFileSizeBytes = size
+	}
+
+	// Validate the flags --max-size and --min-size
+	maxSizeBytes, minSizeBytes = 0, 0
+	if maxSize != "" {
+		size, err := humanize.ParseBytes(maxSize)
+		if err != nil {
+			return fmt.Errorf("max size is invalid: %s", maxSize)
+		}
+		maxSizeBytes = size
+	}
+	if minSize != "" {
+		size, err := humanize.ParseBytes(minSize)
+		if err != nil {
+			return fmt.Errorf("min size is invalid: %s", minSize)
+		}
+		minSizeBytes = size
+	}
+	if maxSizeBytes > 0 && minSizeBytes > maxSizeBytes {
+		return fmt.Errorf("min size is larger than max size: %s > %s", minSize, maxSize)
+	}
+
+	// Validate the flag --tree-style, resolving auto to unicode on a terminal and plain otherwise
+	if treeStyle == "auto" {
+		if isTerminal(os.Stdout) {
+			treeStyle = "unicode"
+		} else {
+			treeStyle = "plain"
+		}
+	}
+	if _, err := parseTreeStyle(treeStyle); err != nil {
+		return fmt.Errorf("tree style is invalid: %s", treeStyle)
+	}
+
+	// Validate the flag --sort
+	order, err := parseSortOrder(sortOrder)
+	if err != nil {
+		return fmt.Errorf("sort order is invalid: %s", sortOrder)
+	}
+	parsedSortOrder = order
+
+	// Validate the flag --sort-by
+	parsedStatsSortKey, err = parseStatsSortKey(sortBy)
+	if err != nil {
+		return fmt.Errorf("sort key is invalid: %s", sortBy)
+	}
+
+	// Validate the flag --binary-action
+	binary, err := parseBinaryAction(binaryAction)
+	if err != nil {
+		return fmt.Errorf("binary action is invalid: %s", binaryAction)
+	}
+	if includeBinary {
+		if cmd.Flags().Changed("binary-action") && binary != BinaryActionInclude {
+			return fmt.Errorf("include-binary cannot be used with binary-action=%s", binaryAction)
+		}
+		binary = BinaryActionInclude
+	}
+	parsedBinaryAction = binary
+
+	// Validate the flag --tree-depth
+	if treeDepth < -1 {
+		return fmt.Errorf("tree depth is invalid: %d", treeDepth)
+	}
+
+	// Validate the flag --contents-ordering
+	ordering, err := parseContentsOrdering(contentsOrdering)
+	if err != nil {
+		return fmt.Errorf("contents ordering is invalid: %s", contentsOrdering)
+	}
+	parsedContentsOrdering = ordering
+
+	// Validate the flag --order-from
+	orderFromPaths = nil
+	if orderFrom != "" {
+		expanded, err := expandTilde(orderFrom)
+		if err != nil {
+			return err
+		}
+		orderFrom = expanded
+		paths, err := readManifest(orderFrom)
+		if err != nil {
+			return fmt.Errorf("order-from file is invalid: %w", err)
+		}
+		orderFromPaths = paths
+	}
+
+	// Validate the flag --sample
+	if sample < 0 {
+		return fmt.Errorf("sample size is invalid: %d", sample)
+	}
+
+	// Validate the flag --truncate-lines
+	if truncateLinesBytes < 0 {
+		return fmt.Errorf("truncate lines is invalid: %d", truncateLinesBytes)
+	}
+
+	// Validate the flag --modified-since
+	modifiedSinceTime = time.Time{}
+	if modifiedSince != "" {
+		t, err := parseSince(modifiedSince, time.Now())
+		if err != nil {
+			return fmt.Errorf("modified since is invalid: %s", modifiedSince)
+		}
+		modifiedSinceTime = t
+	}
+
+	// Validate the flag --before
+	modifiedBeforeTime = time.Time{}
+	if modifiedBefore != "" {
+		t, err := parseSince(modifiedBefore, time.Now())
+		if err != nil {
+			return fmt.Errorf("before is invalid: %s", modifiedBefore)
+		}
+		modifiedBeforeTime = t
+		if !modifiedSinceTime.IsZero() && !modifiedSinceTime.Before(modifiedBeforeTime) {
+			return fmt.Errorf("modified since must be before --before: %s, %s", modifiedSince, modifiedBefore)
+		}
+	}
+
+	// Validate the flag --concurrency
+	if concurrency < 1 {
+		return fmt.Errorf("concurrency is invalid: %d", concurrency)
+	}
+
+	// Validate the flag --max-tokens
+	if maxTokens < 0 {
+		return fmt.Errorf("max tokens is invalid: %d", maxTokens)
+	}
+
+	// Validate the flag --progressive-detail
+	if progressiveDetail && maxTokens == 0 {
+		return fmt.Errorf("progressive detail requires --max-tokens")
+	}
+	if progressiveDetail && truncate {
+		return fmt.Errorf("progressive detail cannot be combined with --truncate")
+	}
+
+	// Validate the flag --max-files
+	if maxFiles < -1 {
+		return fmt.Errorf("max files is invalid: %d", maxFiles)
+	}
+
+	// Validate the flag --confirm-threshold-bytes
+	confirmThresholdBytes = 0
+	if confirmThreshold != "" {
+		size, err := humanize.ParseBytes(confirmThreshold)
+		if err != nil {
+			return fmt.Errorf("confirm threshold is invalid: %s", confirmThreshold)
+		}
+		confirmThresholdBytes = size
+	}
+	// The default size check only applies on a terminal, so piped and CI runs that never needed confirmation keep working
+	if !cmd.Flags().Changed("confirm-threshold-bytes") && !isTerminal(os.Stdin) {
+		confirmThresholdBytes = 0
+	}
+
+	// Validate the flag --action
+	var invalidActions []string
+	for _, action := range actions {
+		if _, err := parseAction(action); err != nil {
+			invalidActions = append(invalidActions, action)
+		}
+	}
+	if len(invalidActions) > 0 {
+		return fmt.Errorf("actions are invalid: %s", strings.Join(invalidActions, ", "))
+	}
+
+	// Validate the flag --format
+	var invalidFormats []string
+	for _, format := range formats {
+		if _, err := parseFormat(format); err != nil {
+			invalidFormats = append(invalidFormats, format)
+		}
+	}
+	if len(invalidFormats) > 0 {
+		return fmt.Errorf("formats are invalid: %s", strings.Join(invalidFormats, ", "))
+	}
+
+	// Validate the flag --route
+	parsedRoutes = nil
+	for _, routeStr := range routes {
+		route, err := parseRoute(routeStr)
+		if err != nil {
+			return fmt.Errorf("route is invalid: %s", routeStr)
+		}
+		parsedRoutes = append(parsedRoutes, route)
+	}
+	if len(parsedRoutes) > 0 && (cmd.Flags().Changed("format") || cmd.Flags().Changed("action")) {
+		return fmt.Errorf("route cannot be combined with --format or --action")
+	}
+	if len(parsedRoutes) > 0 && progressiveDetail {
+		return fmt.Errorf("route cannot be combined with --progressive-detail")
+	}
+
+	// Validate the save action, which writes the --output file
+	isSaveRouted := slices.ContainsFunc(parsedRoutes, func(route Route) bool { return route.Action == ActionSave })
+	if (slices.Contains(actions, "save") || isSaveRouted) && (output == "" || output == "-" || splitByRoot) {
+		return fmt.Errorf("save action requires --output with a file path, and cannot be combined with --split-by-root")
+	}
+
+	// Validate the matches format, which needs patterns to match lines against, and the flag --context
+	usesMatches := slices.Contains(formats, "matches") || slices.ContainsFunc(parsedRoutes, func(route Route) bool { return route.Format == FormatMatches })
+	if usesMatches && len(substrings) == 0 && len(contentSubstrings) == 0 {
+		return fmt.Errorf("matches format requires --substring or --content-substring")
+	}
+	if contextLines < 0 {
+		return fmt.Errorf("context must be at least 0")
+	}
+	if cmd.Flags().Changed("context") && !usesMatches {
+		return fmt.Errorf("context requires the matches format")
+	}
+
+	// Validate the flag --split-by-root
+	if splitByRoot && (output == "" || output == "-") {
+		return fmt.Errorf("split-by-root requires --output with a file path")
+	}
+
+	// Expand and validate the flag --output
+	if output != "" && output != "-" {
+		expanded, err := expandTilde(output)
+		if err != nil {
+			return err
+		}
+		output = expanded
+		if info, err := os.Stat(output); err == nil && !splitByRoot {
+			if info.IsDir() {
+				return fmt.Errorf("output file is a directory: %s", output)
+			}
+			if !force {
+				return fmt.Errorf("output file already exists (pass --force to overwrite): %s", output)
+			}
+		}
+	}
+
+	// Validate the flag --on-invalid-utf8
+	if _, err := parseInvalidUTF8Policy(onInvalidUTF8); err != nil {
+		return fmt.Errorf("invalid UTF-8 policy is invalid: %s", onInvalidUTF8)
+	}
+
+	// Validate the flags --template and --template-file
+	parsedTemplate = nil
+	if templateText != "" && templateFile != "" {
+		return fmt.Errorf("template cannot be combined with --template-file")
+	}
+	if templateText != "" || templateFile != "" {
+		if markdown {
+			return fmt.Errorf("template cannot be combined with --markdown")
+		}
+		text, err := unescape(templateText)
+		if err != nil {
+			return fmt.Errorf("template is invalid: %s", templateText)
+		}
+		if templateFile != "" {
+			expanded, err := expandTilde(templateFile)
+			if err != nil {
+				return err
+			}
+			content, err := os.ReadFile(expanded)
+			if err != nil {
+				return fmt.Errorf("template file is invalid: %w", err)
+			}
+			text = string(content)
+		}
+		tmpl, err := template.New("template").Parse(text)
+		if err != nil {
+			return fmt.Errorf("template is invalid: %w", err)
+		}
+		parsedTemplate = tmpl
+	}
+
+	// Validate the flag --clipboard
+	backend, err := parseClipboardBackend(clipboard)
+	if err != nil {
+		return fmt.Errorf("clipboard backend is invalid: %s", clipboard)
+	}
+	parsedClipboardBackend = backend
+
+	// Validate the flag --max-copy-size
+	maxCopySizeBytes = 0
+	if maxCopySize != "" {
+		size, err := humanize.ParseBytes(maxCopySize)
+		if err != nil {
+			return fmt.Errorf("max copy size is invalid: %s", maxCopySize)
+		}
+		maxCopySizeBytes = size
+	}
+
+	// Validate the flags --prompt, --prompt-file, and --prompt-position
+	parsedPrompt = nil
+	if promptText != "" && promptFile != "" {
+		return fmt.Errorf("prompt cannot be combined with --prompt-file")
+	}
+	if promptText != "" || promptFile != "" {
+		text, err := unescape(promptText)
+		if err != nil {
+			return fmt.Errorf("prompt is invalid: %s", promptText)
+		}
+		if promptFile != "" {
+			expanded, err := expandTilde(promptFile)
+			if err != nil {
+				return err
+			}
+			content, err := os.ReadFile(expanded)
+			if err != nil {
+				return fmt.Errorf("prompt file is invalid: %w", err)
+			}
+			text = string(content)
+		}
+		tmpl, err := template.New("prompt").Parse(strings.TrimSpace(text))
+		if err != nil {
+			return fmt.Errorf("prompt is invalid: %w", err)
+		}
+		parsedPrompt = tmpl
+	}
+	position, err := parsePromptPosition(promptPosition)
+	if err != nil {
+		return fmt.Errorf("prompt position is invalid: %s", promptPosition)
+	}
+	parsedPromptPosition = position
+
+	// Validate the flag --stats
+	statsMode, err := parseStatsMode(showStats)
+	if err != nil {
+		return fmt.Errorf("stats mode is invalid: %s", showStats)
+	}
+	parsedStatsMode = statsMode
+
+	// Validate the flags --file-header and --file-footer
+	if (fileHeader != "" || fileFooter != "") && (templateText != "" || templateFile != "") {
+		return fmt.Errorf("file header and footer cannot be combined with --template or --template-file")
+	}
+	if parsedFileHeader, err = unescape(fileHeader); err != nil {
+		return fmt.Errorf("file header is invalid: %s", fileHeader)
+	}
+	if parsedFileFooter, err = unescape(fileFooter); err != nil {
+		return fmt.Errorf("file footer is invalid: %s", fileFooter)
+	}
+
+	// Validate the flag --header-template, executing it once so unknown fields are reported up front
+	parsedHeaderTemplate = nil
+	if headerTemplate != "" {
+		if fileHeader != "" || templateText != "" || templateFile != "" {
+			return fmt.Errorf("header template cannot be combined with --file-header, --template, or --template-file")
+		}
+		text, err := unescape(headerTemplate)
+		if err != nil {
+			return fmt.Errorf("header template is invalid: %s", headerTemplate)
+		}
+		tmpl, err := template.New("header").Parse(text)
+		if err != nil {
+			return fmt.Errorf("header template is invalid: %w", err)
+		}
+		if err := tmpl.Execute(io.Discard, HeaderData{}); err != nil {
+			return fmt.Errorf("header template is invalid: %w", err)
+		}
+		parsedHeaderTemplate = tmpl
+	}
+
+	// Validate the flags --prefix and --suffix
+	if parsedPrefix, err = unescape(prefix); err != nil {
+		return fmt.Errorf("prefix is invalid: %s", prefix)
+	}
+	if parsedSuffix, err = unescape(suffix); err != nil {
+		return fmt.Errorf("suffix is invalid: %s", suffix)
+	}
+
+	// Validate the flag --format-separator
+	separator, err := unescape(formatSep)
+	if err != nil {
+		return fmt.Errorf("format separator is invalid: %s", formatSep)
+	}
+	parsedFormatSeparator = separator
+	return nil
+}
+
+func main() {
+	// Configure the logger
+	logutils.Configure(logutils.Configuration{IsJSONEnabled: false})
 
 	// Define the root command
-	rootCmd.Flags().StringSliceVar(&dirs, "dir", []string{"."}, "Directories to search (comma-separated, default [.])")
-	rootCmd.Flags().IntVar(&dirDepth, "dir-depth", -1, "Maximum directory depth to search (default -1, meaning infinite)")
-	rootCmd.Flags().StringSliceVar(&exts, "ext", []string{}, "File extensions to include with leading dot (comma-separated, default []). Example: .ts, .tsx")
+	rootCmd.Flags().StringSliceVar(&dirs, "dir", []string{"."}, "Directories or glob patterns to search (comma-separated, default [.])")
+	rootCmd.Flags().StringVar(&fromFile, "from-file", "", "File of newline-separated paths to process instead of searching directories, or - for stdin (default none)")
+	rootCmd.Flags().BoolVarP(&nullSeparated, "null", "0", false, "Separate the paths from --from-file or --stdin by NUL bytes instead of newlines (default false)")
+	rootCmd.Flags().BoolVar(&strict, "strict", false, "Fail on unreadable files and directories, and on missing paths from --from-file or --stdin (default false)")
+	rootCmd.Flags().BoolVar(&readStdin, "stdin", false, "Read newline-separated file paths from stdin instead of searching directories (default false)")
+	rootCmd.Flags().StringVar(&gitDiff, "git-diff", "", "Only include files that differ from a git ref (default HEAD when set without a value)")
+	rootCmd.Flags().Lookup("git-diff").NoOptDefVal = "HEAD"
+	rootCmd.Flags().BoolVar(&gitDiffUntracked, "git-diff-untracked", false, "Also include untracked files with --git-diff (default false)")
+	rootCmd.Flags().IntVar(&dirDepth, "dir-depth", -1, "Maximum directory depth to search, 0 or 1 meaning only the top level (default -1, meaning infinite)")
+	rootCmd.Flags().StringSliceVar(&exts, "ext", []string{}, "File extensions to include with leading dot, or to exclude with a leading ! (comma-separated, default []). Example: .ts, !.lock")
 	rootCmd.Flags().StringSliceVar(&substrings, "substring", []string{}, "Substrings to filter files by (comma-separated, default [])")
-	rootCmd.Flags().StringSliceVar(&actions, "action", []string{"print", "copy"}, "Actions to perform: print, copy (comma-separated, default print,copy)")
-	rootCmd.Flags().StringSliceVar(&formats, "format", []string{"tree", "contents"}, "Output formats: tree, list, contents (comma-separated, default tree,contents)")
-	rootCmd.PreRunE = PreRunE
+	rootCmd.Flags().StringSliceVar(&pathSubstrings, "path-substring", []string{}, "Substrings to filter file paths by (comma-separated, default [])")
+	rootCmd.Flags().StringSliceVar(&contentSubstrings, "content-substring", []string{}, "Substrings to filter file contents by (comma-separated, default [])")
+	rootCmd.Flags().BoolVar(&useRegex, "regex", false, "Interpret --substring values as regular expressions (default false)")
+	rootCmd.Flags().StringSliceVar(&excludes, "exclude", []string{}, "Substrings to exclude files by (comma-separated, default [])")
+	rootCmd.Flags().BoolVar(&followSymlinks, "follow-symlinks", false, "Follow symlinked files and directories, skipping cycles (default false)")
+	rootCmd.Flags().StringSliceVar(&excludeDirs, "exclude-dir", []string{}, "Directory names or relative paths to skip (comma-separated, default [])")
+	rootCmd.Flags().BoolVar(&noDefaultIgnores, "no-default-ignores", false, "Search directories that are ignored by default, such as node_modules (default false)")
+	rootCmd.Flags().BoolVar(&showIgnored, "show-ignored", false, "Print the directories skipped by the default ignore list (default false)")
+	rootCmd.Flags().BoolVar(&includeHidden, "include-hidden", false, "Include hidden files and directories (default false)")
+	rootCmd.Flags().BoolVar(&caseSensitive, "case-sensitive", false, "Match extensions and path substrings case-sensitively (default false)")
+	rootCmd.Flags().BoolVar(&smartCase, "smart-case", false, "Match patterns case-sensitively only if they contain an uppercase letter (default false)")
+	rootCmd.Flags().StringVar(&modifiedBefore, "before", "", "Only include files modified before a duration ago (e.g. 7d), a date, or an RFC3339 time (default none)")
+	rootCmd.Flags().StringVar(&modifiedSince, "modified-since", "", "Only include files modified within a duration (e.g. 24h, 7d) or since a date or RFC3339 time (default none)")
+	rootCmd.Flags().StringVar(&maxSize, "max-size", "", "Skip files larger than this size, e.g. 512KB (default unlimited)")
+	rootCmd.Flags().StringVar(&minSize, "min-size", "", "Skip files smaller than this size, e.g. 1B (default none)")
+	rootCmd.Flags().StringVar(&maxFileSize, "max-file-size", "", "Maximum size of files to read, e.g. 100KB, 2MB (default unlimited)")
+	rootCmd.Flags().IntVar(&concurrency, "concurrency", runtime.NumCPU(), "Number of files to read concurrently (default number of CPUs)")
+	rootCmd.Flags().StringVar(&binaryAction, "binary-action", "skip", "Treatment of binary files: skip, placeholder, include (default skip)")
+	rootCmd.Flags().BoolVar(&includeBinary, "include-binary", false, "Include binary files as a hex dump, same as --binary-action=include (default false)")
+	rootCmd.Flags().BoolVar(&redact, "redact", false, "Replace common secrets such as API keys with [REDACTED] in every file, not only .env files (default false)")
+	rootCmd.Flags().StringArrayVar(&redactPatterns, "redact-pattern", []string{}, "Regular expression of secrets to redact instead of the built-in patterns (repeatable, default none)")
+	rootCmd.Flags().BoolVar(&treeStats, "tree-stats", false, "Show line counts and byte sizes in the tree format (default false)")
+	rootCmd.Flags().StringVar(&treeStyle, "tree-style", "auto", "Tree style: auto, plain, unicode (default auto)")
+	rootCmd.Flags().BoolVar(&treeReadmeHints, "tree-readme-hints", false, "Annotate directories in the tree format with the first line of their README (default false)")
+	rootCmd.Flags().IntVar(&treeDepth, "tree-depth", -1, "Maximum depth to expand in the tree format (default -1, meaning infinite)")
+	rootCmd.Flags().StringVar(&sortOrder, "sort", "name", "Order of files within each format: name, modified, size, ext, none (default name)")
+	rootCmd.Flags().BoolVar(&reverseSort, "reverse", false, "Reverse the --sort order (default false)")
+	rootCmd.Flags().StringVar(&sortBy, "sort-by", "", "Order of the per-file table in the stats format: name, size, lines, modtime (default the --sort order)")
+	rootCmd.Flags().StringVar(&contentsOrdering, "contents-ordering", "walk", "Order of files in the contents format: walk, imports-first (default walk)")
+	rootCmd.Flags().IntVar(&truncateLinesBytes, "truncate-lines", 0, "Maximum bytes per line in the contents format (default 0, meaning unlimited)")
+	rootCmd.Flags().StringVar(&templateText, "template", "", "Go template for each file in the contents format, e.g. '{{.Path}}:\\n{{.Content}}' (default none)")
+	rootCmd.Flags().StringVar(&templateFile, "template-file", "", "File to read the --template from (default none)")
+	rootCmd.Flags().BoolVar(&markdown, "markdown", false, "Emit the contents format as markdown with fenced code blocks (default false)")
+	rootCmd.Flags().StringVar(&fileHeader, "file-header", "", "Header before each file in the contents format, with {path} and {ext} placeholders (default '# {path}\\n')")
+	rootCmd.Flags().StringVar(&fileFooter, "file-footer", "", "Footer after each file in the contents format, with {path} and {ext} placeholders (default '\\n')")
+	rootCmd.Flags().StringVar(&headerTemplate, "header-template", "", "Go template for the header before each file in the contents format (default '# {{.Path}}')")
+	rootCmd.Flags().BoolVar(&lineNumbers, "line-numbers", false, "Prefix each line in the contents format with its line number (default false)")
+	rootCmd.Flags().StringVar(&orderFrom, "order-from", "", "File listing paths in the order to emit them in the contents format (default none)")
+	rootCmd.Flags().BoolVar(&readmeFirst, "readme-first", false, "Emit README files first within each directory in the contents format (default false)")
+	rootCmd.Flags().BoolVar(&listTokens, "list-tokens", false, "Show estimated tokens per file in the list format (default false)")
+	rootCmd.Flags().BoolVar(&listModTime, "list-modtime", false, "Show the modification time of each file in the list format (default false)")
+	rootCmd.Flags().IntVar(&maxTokens, "max-tokens", 0, "Maximum estimated tokens of the output (default 0, meaning unlimited)")
+	rootCmd.Flags().BoolVar(&progressiveDetail, "progressive-detail", false, "Reduce detail until the output fits --max-tokens (default false)")
+	rootCmd.Flags().BoolVar(&truncate, "truncate", false, "Drop the largest files until the output fits --max-tokens (default false)")
+	rootCmd.Flags().IntVar(&maxFiles, "max-files", 50, "Confirm before processing more than this many files (default 50, 0 means never, -1 always)")
+	rootCmd.Flags().StringVar(&confirmThreshold, "confirm-threshold-bytes", "1MB", "Confirm before processing more than this many bytes, e.g. 1MB (default 1MB)")
+	rootCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip the confirmation prompt (default false)")
+	rootCmd.Flags().IntVar(&sample, "sample", 0, "Select N files at random from the matched files (default 0, meaning all)")
+	rootCmd.Flags().Int64Var(&seed, "seed", 0, "Random seed for --sample (default random)")
+	rootCmd.Flags().StringSliceVar(&actions, "action", []string{"print", "copy"}, "Actions to perform: print, copy, save (comma-separated, default print,copy)")
+	rootCmd.Flags().BoolVar(&countOnly, "count-only", false, "Print only the number of matched files (default false)")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List and summarize the files that would be processed, without rendering or acting (default false)")
+	rootCmd.Flags().BoolVar(&relative, "relative", false, "Emit paths relative to the current directory, keeping absolute paths outside of it (default false)")
+	rootCmd.Flags().IntVarP(&contextLines, "context", "C", 0, "Lines of context around each matching line in the matches format (default 0)")
+	rootCmd.Flags().StringSliceVar(&formats, "format", []string{"tree", "contents"}, "Output formats: tree, list, contents, summary, stats, matches, xml, signatures, paths0 (comma-separated, default tree,contents)")
+	rootCmd.Flags().StringSliceVar(&routes, "route", []string{}, "Formats to route to their own action, e.g. tree=print (repeatable, default none)")
+	rootCmd.Flags().StringVar(&formatSep, "format-separator", `\n\n`, "Separator between formats, with escape sequences such as \\n (default \\n\\n)")
+	rootCmd.Flags().StringVar(&showStats, "stats", "", "Summarize the files after the output: stderr, append (default stderr when set without a value)")
+	rootCmd.Flags().Lookup("stats").NoOptDefVal = "stderr"
+	rootCmd.Flags().StringVar(&prefix, "prefix", "", "Text to add before the output, with escape sequences such as \\n (default none)")
+	rootCmd.Flags().StringVar(&suffix, "suffix", "", "Text to add after the output, with escape sequences such as \\n (default none)")
+	rootCmd.Flags().StringVar(&clipboard, "clipboard", "auto", "Clipboard backend for the copy action: auto, native, osc52 (default auto)")
+	rootCmd.Flags().StringVar(&maxCopySize, "max-copy-size", "10MB", "Largest output to copy to the clipboard, e.g. 2MB, or 0 for unlimited (default 10MB)")
+	rootCmd.Flags().BoolVar(&forceCopy, "force-copy", false, "Copy outputs larger than --max-copy-size anyway (default false)")
+	rootCmd.Flags().BoolVar(&interactive, "interactive", false, "Pick the files in a terminal picker before rendering (default false)")
+	rootCmd.Flags().BoolVar(&watch, "watch", false, "Rerun whenever files change (default false)")
+	rootCmd.Flags().BoolVar(&splitByRoot, "split-by-root", false, "Write a separate --output file for each directory (default false)")
+	rootCmd.Flags().StringVarP(&output, "output", "o", "", "File to write the output to, or - for stdout (default none)")
+	rootCmd.Flags().BoolVar(&force, "force", false, "Overwrite the --output file if it exists (default false)")
+	rootCmd.Flags().StringVar(&configProfile, "profile", "", "Named profile from the config file to apply (default none)")
+	rootCmd.Flags().BoolVar(&noConfig, "no-config", false, "Skip loading the config file (default false)")
+	rootCmd.Flags().BoolVar(&logJSON, "log-json", false, "Write logs as JSON (default false)")
+	rootCmd.Flags().StringVar(&logLevel, "log-level", "info", "Minimum level of logs to write: debug, info, warn, error (default info)")
+	rootCmd.Flags().StringVar(&promptText, "prompt", "", "Instructions to add to the output, with template fields such as {{.FileCount}} (default none)")
+	rootCmd.Flags().StringVar(&promptFile, "prompt-file", "", "File to read the --prompt text from (default none)")
+	rootCmd.Flags().StringVar(&promptPosition, "prompt-position", "start", "Where to place the prompt: start, end (default start)")
+	rootCmd.Flags().StringVar(&onInvalidUTF8, "on-invalid-utf8", "replace", "Treatment of invalid UTF-8 in the output: error, replace, keep (default replace)")
+	rootCmd.Flags().SetNormalizeFunc(normalizeFlagName)
+	rootCmd.PersistentPreRunE = PersistentPreRunE
+	rootCmd.PreRunE = withConfigSource(PreRunE)
 	rootCmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
 		help, _ := generateHelpMessage()
 		fmt.Println(help)
 	})
 
+	// Cancel the context on SIGINT or SIGTERM so the walk and reads stop promptly.
+	// After the first signal, restore the default behavior so a second one exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	// Execute the root command
-	if err := rootCmd.Execute(); err != nil {
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		os.Exit(1)
 	}
 }
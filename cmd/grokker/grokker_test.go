@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestMain runs grokker instead of the tests when the test binary is re-executed by runGrokker,
+// so each end-to-end test gets fresh flags, its own stdin, and its own exit code.
+func TestMain(m *testing.M) {
+	if os.Getenv("GROKKER_TEST_MAIN") == "1" {
+		os.Args = append([]string{"grokker"}, os.Args[1:]...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runGrokker runs grokker with args in dir, reading stdin from a pipe (so never a terminal), and returns what it wrote
+// to stdout and stderr. The config file is never loaded. err is non-nil if grokker exited with a non-zero code.
+func runGrokker(t *testing.T, dir, stdin string, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(exe, append([]string{"--no-config"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GROKKER_TEST_MAIN=1", "NO_COLOR=1")
+	cmd.Stdin = strings.NewReader(stdin)
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &outBuf, &errBuf
+	err = cmd.Run()
+	return outBuf.String(), errBuf.String(), err
+}
+
+// writeFixture creates the files, keyed by slash-separated paths, in a temporary directory and returns the directory.
+func writeFixture(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for path, content := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// listedPaths runs grokker with the list format and returns the paths it printed.
+func listedPaths(t *testing.T, dir string, args ...string) []string {
+	t.Helper()
+	stdout, stderr, err := runGrokker(t, dir, "", append([]string{"-y", "--action=print", "--format=list"}, args...)...)
+	if err != nil {
+		t.Fatalf("grokker %s failed: %v\n%s", strings.Join(args, " "), err, stderr)
+	}
+	return nonEmptyLines(stdout)
+}
+
+// contentsPaths runs grokker with the contents format and returns the paths of the file headers it printed.
+func contentsPaths(t *testing.T, dir string, args ...string) []string {
+	t.Helper()
+	stdout, stderr, err := runGrokker(t, dir, "", append([]string{"-y", "--action=print", "--format=contents"}, args...)...)
+	if err != nil {
+		t.Fatalf("grokker %s failed: %v\n%s", strings.Join(args, " "), err, stderr)
+	}
+	var paths []string
+	for _, line := range nonEmptyLines(stdout) {
+		if path, ok := strings.CutPrefix(line, "# "); ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// nonEmptyLines splits s into lines, dropping empty lines and the "No files found." message.
+func nonEmptyLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" && line != "No files found." {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// treeFiles runs grokker with the tree format and returns the names of the files in the tree, ending in ext.
+func treeFiles(t *testing.T, dir, ext string, args ...string) []string {
+	t.Helper()
+	stdout, stderr, err := runGrokker(t, dir, "", append([]string{"-y", "--action=print", "--format=tree", "--tree-style=plain"}, args...)...)
+	if err != nil {
+		t.Fatalf("grokker %s failed: %v\n%s", strings.Join(args, " "), err, stderr)
+	}
+	var names []string
+	for _, line := range nonEmptyLines(stdout) {
+		if name := strings.TrimSpace(line); strings.HasSuffix(name, ext) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestContentFilterFormatsAgree(t *testing.T) {
+	// More files than readBatchSize, so the filter reads several batches
+	files := make(map[string]string)
+	var want []string
+	for i := range 2*readBatchSize + 10 {
+		path := fmt.Sprintf("dir%d/file%03d.txt", i%3, i)
+		if i%7 == 0 {
+			files[path] = "a needle in the haystack\n"
+			want = append(want, path)
+		} else {
+			files[path] = "only hay\n"
+		}
+	}
+	dir := writeFixture(t, files)
+	slices.Sort(want)
+	for _, flag := range []string{"--substring=needle", "--content-substring=needle"} {
+		t.Run(flag, func(t *testing.T) {
+			if got := listedPaths(t, dir, flag); !slices.Equal(got, want) {
+				t.Errorf("list = %q, want %q", got, want)
+			}
+			if got := contentsPaths(t, dir, flag); !slices.Equal(got, want) {
+				t.Errorf("contents = %q, want %q", got, want)
+			}
+			var wantNames []string
+			for _, path := range want {
+				wantNames = append(wantNames, filepath.Base(path))
+			}
+			slices.Sort(wantNames)
+			got := treeFiles(t, dir, ".txt", flag)
+			slices.Sort(got)
+			if !slices.Equal(got, wantNames) {
+				t.Errorf("tree = %q, want %q", got, wantNames)
+			}
+		})
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    bool
+	}{
+		{"empty", nil, false},
+		{"text", []byte("package main\n"), false},
+		{"NUL at the start", []byte("\x00ELF"), true},
+		{"NUL at the last sniffed byte", append(bytes.Repeat([]byte("a"), binarySniffBytes-1), 0), true},
+		{"NUL after the sniffed bytes", append(bytes.Repeat([]byte("a"), binarySniffBytes), 0), false},
+	}
+	for _, tt := range tests {
+		if got := isBinary(tt.content); got != tt.want {
+			t.Errorf("isBinary(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConfirmationWithoutTerminal(t *testing.T) {
+	dir := writeFixture(t, depthFixture)
+
+	// A piped "y" must not be read as an answer: without a terminal, grokker fails instead of prompting
+	stdout, stderr, err := runGrokker(t, dir, "y\n", "--action=print", "--format=list", "--max-files=1")
+	if err == nil {
+		t.Fatalf("grokker succeeded without a terminal, want an error\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "stdin is not a terminal; pass --yes to proceed") {
+		t.Errorf("stderr = %q, want the message to pass --yes", stderr)
+	}
+	if strings.Contains(stdout, "top.txt") {
+		t.Errorf("stdout = %q, want no output", stdout)
+	}
+
+	for _, flag := range []string{"--yes", "-y", "--max-files=0"} {
+		stdout, stderr, err := runGrokker(t, dir, "", "--action=print", "--format=list", "--max-files=1", flag)
+		if err != nil {
+			t.Fatalf("grokker %s failed: %v\n%s", flag, err, stderr)
+		}
+		if len(nonEmptyLines(stdout)) != len(depthFixture) {
+			t.Errorf("grokker %s printed %q, want every file", flag, stdout)
+		}
+	}
+}
+
+func TestExcludeWinsOverSubstring(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		"both.txt":      "keep this, but it is generated\n",
+		"keep.txt":      "keep this\n",
+		"other.txt":     "nothing to see\n",
+		"generated.txt": "keep this too\n",
+	})
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"content matches both", []string{"--substring=keep", "--exclude=generated"}, []string{"keep.txt"}},
+		{"path matches the exclude", []string{"--substring=keep", "--exclude=both.txt,generated.txt"}, []string{"keep.txt"}},
+		{"content substring and exclude", []string{"--content-substring=keep", "--exclude=generated"}, []string{"keep.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listedPaths(t, dir, tt.args...); !slices.Equal(got, tt.want) {
+				t.Errorf("list = %q, want %q", got, tt.want)
+			}
+			if got := contentsPaths(t, dir, tt.args...); !slices.Equal(got, tt.want) {
+				t.Errorf("contents = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureValidUTF8(t *testing.T) {
+	t.Cleanup(func() { onInvalidUTF8 = "replace" })
+	tests := []struct {
+		policy  string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"replace", "ok", "ok", false},
+		{"replace", "a\xff\xfeb", "a�b", false},
+		{"error", "ok", "ok", false},
+		{"error", "a\xffb", "", true},
+		{"keep", "a\xffb", "a\xffb", false},
+	}
+	for _, tt := range tests {
+		onInvalidUTF8 = tt.policy
+		got, err := ensureValidUTF8(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ensureValidUTF8(%q) with %s = %q, %v, want %q (error %v)", tt.input, tt.policy, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestOnInvalidUTF8(t *testing.T) {
+	dir := writeFixture(t, map[string]string{"latin1.txt": "caf\xe9\n"})
+	// The print action alone streams the output, and --max-tokens renders it in memory first
+	for _, args := range [][]string{{"--action=print"}, {"--action=print", "--max-tokens=1000"}} {
+		for _, tt := range []struct {
+			policy  string
+			want    string
+			wantErr bool
+		}{
+			{"replace", "caf�", false},
+			{"keep", "caf\xe9", false},
+			{"error", "", true},
+		} {
+			stdout, stderr, err := runGrokker(t, dir, "", append([]string{"-y", "--format=contents", "--on-invalid-utf8=" + tt.policy}, args...)...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("%s %s: error = %v, want error %v\n%s", tt.policy, args, err, tt.wantErr, stderr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(stderr, "not valid UTF-8") || strings.Contains(stdout, "caf") {
+					t.Errorf("%s %s: stdout %q, stderr %q, want only the error", tt.policy, args, stdout, stderr)
+				}
+				continue
+			}
+			if !strings.Contains(stdout, tt.want+"\n") {
+				t.Errorf("%s %s: stdout = %q, want %q", tt.policy, args, stdout, tt.want)
+			}
+		}
+	}
+}
+
+func TestSmartCase(t *testing.T) {
+	defer func(smart, sensitive bool) { smartCase, caseSensitive = smart, sensitive }(smartCase, caseSensitive)
+	smartCase, caseSensitive = true, false
+
+	// Lowercase patterns ignore case, and patterns with an uppercase letter match case exactly, even in one list
+	patterns := []string{"todo", "FixMe"}
+	regexes, err := compileRegexes([]string{"to+do", "Fix[Mm]e"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"// todo: later", true},
+		{"// TODO: later", true},
+		{"// ToDo: later", true},
+		{"// FixMe: now", true},
+		{"// fixme: now", false},
+		{"// FIXME: now", false},
+		{"nothing here", false},
+	}
+	for _, tt := range tests {
+		if got := anyContentSubstringMatches(patterns, tt.content); got != tt.want {
+			t.Errorf("substrings %q in %q = %v, want %v", patterns, tt.content, got, tt.want)
+		}
+		if got := anyContentRegexMatches(regexes, tt.content); got != tt.want {
+			t.Errorf("regexes in %q = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+
+	// Paths follow the same rule
+	for _, tt := range []struct {
+		path, sub string
+		want      bool
+	}{
+		{"src/Handler.go", "handler", true},
+		{"src/Handler.go", "Handler", true},
+		{"src/handler.go", "Handler", false},
+	} {
+		if got := pathContains(tt.path, tt.sub); got != tt.want {
+			t.Errorf("pathContains(%q, %q) = %v, want %v", tt.path, tt.sub, got, tt.want)
+		}
+	}
+
+	// Without --smart-case, contents always match case exactly
+	smartCase = false
+	if anyContentSubstringMatches([]string{"todo"}, "TODO") {
+		t.Error("contents matched case-insensitively without --smart-case")
+	}
+}
+
+func TestExpandTilde(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path, want string
+	}{
+		{"~", home},
+		{"~/src/app", filepath.Join(home, "src", "app")},
+		{"~" + current.Username, current.HomeDir},
+		{"~" + current.Username + "/src", filepath.Join(current.HomeDir, "src")},
+		{"~nosuchuser-grokker/src", "~nosuchuser-grokker/src"},
+		{"src/~backup", "src/~backup"},
+		{"/tmp/x", "/tmp/x"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, err := expandTilde(tt.path)
+		if err != nil || got != tt.want {
+			t.Errorf("expandTilde(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestSummaryLeavesSkippedFilesOutOfTotal(t *testing.T) {
+	dir := writeFixture(t, map[string]string{"a.txt": "hi\n", "b.txt": "one\ntwo\n", "big.txt": strings.Repeat("x", 5000)})
+	stdout, stderr, err := runGrokker(t, dir, "", "-y", "--action=print", "--format=summary", "--max-file-size=1KB")
+	if err != nil {
+		t.Fatalf("grokker failed: %v\n%s", err, stderr)
+	}
+	rows := make(map[string][]string)
+	for _, line := range nonEmptyLines(stdout) {
+		fields := strings.Fields(line)
+		rows[fields[0]] = fields[1:]
+	}
+	if got, want := rows["total"], []string{"3", "11", "3"}; !slices.Equal(got, want) {
+		t.Errorf("total = %q, want %q (without big.txt)\n%s", got, want, stdout)
+	}
+	if got, want := rows["skipped"], []string{"-", "5,000", "1,250"}; !slices.Equal(got, want) {
+		t.Errorf("skipped = %q, want %q\n%s", got, want, stdout)
+	}
+}
+
+func TestMaxCopySize(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake clipboard tool is a shell script")
+	}
+	// A fake xclip, the only clipboard tool on PATH, records what it was given
+	bin := t.TempDir()
+	clipboard := filepath.Join(bin, "clipboard")
+	script := "#!/bin/sh\nexec /bin/cat > '" + clipboard + "'\n"
+	if err := os.WriteFile(filepath.Join(bin, "xclip"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	dir := writeFixture(t, map[string]string{"big.txt": strings.Repeat("x", 2000)})
+
+	tests := []struct {
+		name    string
+		args    []string
+		refused bool
+	}{
+		{"over the limit", []string{"--max-copy-size=1KB"}, true},
+		{"forced", []string{"--max-copy-size=1KB", "--force-copy"}, false},
+		{"unlimited", []string{"--max-copy-size=0"}, false},
+		{"under the limit", []string{"--max-copy-size=1MB"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(clipboard)
+			args := append([]string{"-y", "--action=print,copy", "--format=contents", "--clipboard=native"}, tt.args...)
+			stdout, stderr, err := runGrokker(t, dir, "", args...)
+			if err != nil {
+				t.Fatalf("grokker failed: %v\n%s", err, stderr)
+			}
+			// The print action runs whether or not the copy is refused
+			if !strings.Contains(stdout, strings.Repeat("x", 2000)) {
+				t.Errorf("stdout is missing the output\n%s", stdout)
+			}
+			if refused := strings.Contains(stderr, "Refused to copy"); refused != tt.refused {
+				t.Errorf("refused = %v, want %v\n%s", refused, tt.refused, stderr)
+			}
+			copied, err := os.ReadFile(clipboard)
+			if tt.refused {
+				if err == nil {
+					t.Errorf("copied %d bytes, want nothing", len(copied))
+				}
+			} else if !strings.Contains(string(copied), strings.Repeat("x", 2000)) {
+				t.Errorf("copied %q, want the output (%v)", copied, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxHintLength is the maximum length of a README hint in the tree format, in characters.
+const maxHintLength = 80
+
+// readmeHint returns the first meaningful line of the README in dir, or "" if there is none.
+// Headings are stripped of their leading #s, and blank lines, HTML, and images (e.g., badges) are skipped.
+// If dir contains several READMEs, the first by name is used so the hint is deterministic.
+func readmeHint(dir string) string {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || !isReadme(dirEntry.Name()) {
+			continue
+		}
+		file, err := os.Open(filepath.Join(dir, dirEntry.Name()))
+		if err != nil {
+			return ""
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(strings.TrimLeft(scanner.Text(), "# \t"))
+			if line == "" || strings.HasPrefix(line, "<") || strings.HasPrefix(line, "![") || strings.HasPrefix(line, "[![") {
+				continue
+			}
+			if len([]rune(line)) > maxHintLength {
+				line = string([]rune(line)[:maxHintLength-1]) + "…"
+			}
+			return line
+		}
+		return ""
+	}
+	return ""
+}
+
+// annotateReadmeHints sets the hint of node, the directory at dir, and of each directory below it
+// to the first meaningful line of its README.
+func annotateReadmeHints(node *TreeNode, dir string) {
+	node.Hint = readmeHint(dir)
+	for name, child := range node.Children {
+		if child.IsDir {
+			annotateReadmeHints(child, filepath.Join(dir, name))
+		}
+	}
+}
+
+// formatHint formats the hint of a node, e.g. "  # Command-line entry points".
+func formatHint(node *TreeNode) string {
+	if node.Hint == "" {
+		return ""
+	}
+	return "  # " + node.Hint
+}
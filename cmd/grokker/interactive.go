@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dustin/go-humanize"
+)
+
+// errPickerAborted is returned by pickEntries when the picker is closed without confirming.
+var errPickerAborted = errors.New("picker aborted")
+
+// pickerItem is a file in the --interactive picker.
+type pickerItem struct {
+	Entry    Entry
+	Selected bool
+}
+
+// pickerModel is the bubbletea model of the --interactive picker: a checkbox list of files grouped by directory,
+// filtered by a fuzzy search, with a footer showing what is selected.
+type pickerModel struct {
+	items     []pickerItem // Files sorted by directory, then name
+	visible   []int        // Indexes of the items that match the query
+	cursor    int          // Index into visible
+	query     string       // Fuzzy search query
+	searching bool         // Whether keys are typed into the query
+	height    int          // Height of the terminal
+	confirmed bool         // Whether the selection was confirmed with enter
+}
+
+// newPickerModel returns a picker of the files in entriesByRoot, all selected.
+func newPickerModel(entriesByRoot map[string][]Entry) *pickerModel {
+	entries := flattenEntries(entriesByRoot)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if dirI, dirJ := filepath.Dir(entries[i].Path), filepath.Dir(entries[j].Path); dirI != dirJ {
+			return dirI < dirJ
+		}
+		return entries[i].Path < entries[j].Path
+	})
+	m := &pickerModel{height: 24}
+	for _, entry := range entries {
+		m.items = append(m.items, pickerItem{Entry: entry, Selected: true})
+	}
+	m.filter()
+	return m
+}
+
+// isFuzzyMatch returns true if the characters of query appear in path in order, ignoring case (e.g., "gkgo" matches "grokker.go").
+func isFuzzyMatch(query, path string) bool {
+	path = strings.ToLower(path)
+	for _, r := range strings.ToLower(query) {
+		i := strings.IndexRune(path, r)
+		if i == -1 {
+			return false
+		}
+		path = path[i+len(string(r)):]
+	}
+	return true
+}
+
+// filter recomputes the visible items from the query and keeps the cursor in range.
+func (m *pickerModel) filter() {
+	m.visible = m.visible[:0]
+	for i, item := range m.items {
+		if isFuzzyMatch(m.query, item.Entry.Path) {
+			m.visible = append(m.visible, i)
+		}
+	}
+	m.cursor = max(0, min(m.cursor, len(m.visible)-1))
+}
+
+// Init implements tea.Model.
+func (m *pickerModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model.
+func (m *pickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			return m, tea.Quit
+		case tea.KeyEsc:
+			// Escape leaves the search first, and aborts otherwise
+			if m.searching {
+				m.searching = false
+				return m, nil
+			}
+			return m, tea.Quit
+		case tea.KeyEnter:
+			if m.searching {
+				m.searching = false
+				return m, nil
+			}
+			m.confirmed = true
+			return m, tea.Quit
+		case tea.KeyUp:
+			m.cursor = max(0, m.cursor-1)
+			return m, nil
+		case tea.KeyDown:
+			m.cursor = min(len(m.visible)-1, m.cursor+1)
+			return m, nil
+		case tea.KeySpace:
+			if !m.searching {
+				if len(m.visible) > 0 {
+					item := &m.items[m.visible[m.cursor]]
+					item.Selected = !item.Selected
+				}
+				return m, nil
+			}
+		case tea.KeyBackspace:
+			if m.searching && m.query != "" {
+				runes := []rune(m.query)
+				m.query = string(runes[:len(runes)-1])
+				m.filter()
+			}
+			return m, nil
+		}
+		if m.searching {
+			if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+				m.query += string(msg.Runes)
+				m.filter()
+			}
+			return m, nil
+		}
+		switch msg.String() {
+		case "q":
+			return m, tea.Quit
+		case "k":
+			m.cursor = max(0, m.cursor-1)
+		case "j":
+			m.cursor = min(len(m.visible)-1, m.cursor+1)
+		case "/":
+			m.searching = true
+		case "a", "n":
+			// Select all or none of the files matching the search
+			for _, i := range m.visible {
+				m.items[i].Selected = msg.String() == "a"
+			}
+		}
+	}
+	return m, nil
+}
+
+// selectedTotals returns the number and total size of the selected files.
+func (m *pickerModel) selectedTotals() (files int, bytes int64) {
+	for _, item := range m.items {
+		if item.Selected {
+			files++
+			bytes += item.Entry.Size
+		}
+	}
+	return files, bytes
+}
+
+// View implements tea.Model.
+func (m *pickerModel) View() string {
+	// Render the visible files with a header for each directory, remembering the line of the cursor
+	var lines []string
+	cursorLine := 0
+	lastDir := ""
+	for i, index := range m.visible {
+		item := m.items[index]
+		if dir := filepath.Dir(item.Entry.Path); i == 0 || dir != lastDir {
+			lines = append(lines, StyleFaint.Render(strings.TrimSuffix(dir, "/")+"/"))
+			lastDir = dir
+		}
+		check := "[ ]"
+		if item.Selected {
+			check = StyleBoldGreen.Render("[x]")
+		}
+		line := "  " + check + " " + filepath.Base(item.Entry.Path)
+		if i == m.cursor {
+			line = StyleBlue.Render(">") + " " + check + " " + StyleBoldWhite.Render(filepath.Base(item.Entry.Path))
+			cursorLine = len(lines)
+		}
+		lines = append(lines, line)
+	}
+
+	// Scroll the list so the cursor stays in view, leaving room for the header, search, and footer
+	listHeight := max(1, m.height-4)
+	start := max(0, cursorLine-listHeight/2)
+	end := min(len(lines), start+listHeight)
+	start = max(0, end-listHeight)
+
+	var b strings.Builder
+	b.WriteString(StyleFaint.Render("space toggle · a all · n none · / search · enter confirm · esc abort") + "\n")
+	if m.searching || m.query != "" {
+		cursor := ""
+		if m.searching {
+			cursor = "█"
+		}
+		b.WriteString(StyleCyan.Render("/"+m.query+cursor) + "\n")
+	}
+	if len(m.visible) == 0 {
+		b.WriteString(StyleFaint.Render("No files match the search.") + "\n")
+	}
+	for _, line := range lines[start:end] {
+		b.WriteString(line + "\n")
+	}
+	files, bytes := m.selectedTotals()
+	b.WriteString(StyleBoldWhite.Render(fmt.Sprintf("%s of %s selected · %s · ~%s tokens", humanize.Comma(int64(files)), humanize.Comma(int64(len(m.items))), humanize.Bytes(uint64(bytes)), humanize.Comma(estimateTokens(bytes)))))
+	return b.String()
+}
+
+// pickEntries shows the --interactive picker on the terminal and returns only the files that were selected,
+// keyed by the same roots as entriesByRoot. It returns errPickerAborted if the picker is closed without confirming,
+// and the context's error if ctx is cancelled.
+func pickEntries(ctx context.Context, entriesByRoot map[string][]Entry) (map[string][]Entry, error) {
+	m := newPickerModel(entriesByRoot)
+	// Render to stderr, so the picker does not end up in piped output
+	program := tea.NewProgram(m, tea.WithContext(ctx), tea.WithOutput(os.Stderr), tea.WithAltScreen())
+	if _, err := program.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to run picker: %w", err)
+	}
+	if !m.confirmed {
+		return nil, errPickerAborted
+	}
+	selected := make(map[string]bool)
+	for _, item := range m.items {
+		if item.Selected {
+			selected[item.Entry.Path] = true
+		}
+	}
+	picked := make(map[string][]Entry)
+	for root, entries := range entriesByRoot {
+		picked[root] = []Entry{}
+		for _, entry := range entries {
+			if selected[entry.Path] {
+				picked[root] = append(picked[root], entry)
+			}
+		}
+	}
+	return picked, nil
+}
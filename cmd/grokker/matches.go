@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// matchGroupSeparator separates groups of lines that are not adjacent when --context is set, like grep.
+const matchGroupSeparator = "--"
+
+// lineRange is an inclusive range of line indexes shown in the matches format.
+type lineRange struct {
+	start, end int
+}
+
+// isLineMatch returns true if the line matches any --substring or --content-substring, as regular expressions with --regex.
+// Only the line is matched, never the path, and case follows --smart-case like content filtering does.
+func isLineMatch(line string) bool {
+	if useRegex {
+		return slices.ContainsFunc(substringRegexes, func(re *regexp.Regexp) bool { return re.MatchString(line) }) ||
+			slices.ContainsFunc(contentRegexes, func(re *regexp.Regexp) bool { return re.MatchString(line) })
+	}
+	m := &contentMatcher{content: line}
+	return slices.ContainsFunc(substrings, m.contains) || slices.ContainsFunc(contentSubstrings, m.contains)
+}
+
+// matchRanges returns the ranges of lines to show around the matching lines, with contextLines lines before and after each.
+// Ranges that overlap or touch are merged, so no line is shown twice.
+func matchRanges(lines []string, contextLines int) []lineRange {
+	var ranges []lineRange
+	for i, line := range lines {
+		if !isLineMatch(line) {
+			continue
+		}
+		r := lineRange{start: max(0, i-contextLines), end: min(len(lines)-1, i+contextLines)}
+		if n := len(ranges); n > 0 && r.start <= ranges[n-1].end+1 {
+			ranges[n-1].end = r.end
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// renderMatches renders the lines that match the patterns like grep -n, as path:line: text, with --context lines
+// before and after each match as path-line- text. With context, groups of lines that are not adjacent are separated by --.
+// Binary files, files over --max-file-size, and files that fail to read are skipped.
+func renderMatches(ctx context.Context, entriesByRoot map[string][]Entry) string {
+	matchEntries := flattenEntries(entriesByRoot)
+	sortEntries(matchEntries, parsedSortOrder)
+	var b strings.Builder
+	hasGroups := false
+	for start := 0; start < len(matchEntries); start += readBatchSize {
+		batch := matchEntries[start:min(start+readBatchSize, len(matchEntries))]
+		matchFiles := readFiles(ctx, batch)
+		for i, entry := range batch {
+			if matchFiles[i].TooLarge {
+				continue
+			}
+			if matchFiles[i].Err != nil {
+				slog.Debug("skipped unreadable file", slog.String("path", entry.Path), slog.String("error", matchFiles[i].Err.Error()))
+				continue
+			}
+			if isBinary(matchFiles[i].Content) {
+				continue
+			}
+			content := redactContent(entry.Path, string(matchFiles[i].Content))
+			lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+			for _, r := range matchRanges(lines, contextLines) {
+				if hasGroups && contextLines > 0 {
+					b.WriteString(matchGroupSeparator + "\n")
+				}
+				hasGroups = true
+				for j := r.start; j <= r.end; j++ {
+					line := strings.TrimSuffix(lines[j], "\r")
+					sep := "-"
+					if isLineMatch(line) {
+						sep = ":"
+					}
+					b.WriteString(entry.Path + sep + strconv.Itoa(j+1) + sep + " " + line + "\n")
+				}
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ContentsOrdering represents the possible orderings of files in the contents format.
+type ContentsOrdering int
+
+const (
+	ContentsOrderingWalk         ContentsOrdering = iota // Ordering to emit files in walk order
+	ContentsOrderingImportsFirst                         // Ordering to emit imported files before the files that import them
+)
+
+// Regular expressions to extract import specifiers from supported languages.
+// They are intentionally lightweight and do not attempt to fully parse the source.
+var (
+	goDeclRegex       = regexp.MustCompile(`(?m)^(?:func|type|var|const)\b`)
+	goImportRegex     = regexp.MustCompile(`(?m)^\s*(?:import\s+)?(?:[\w.]+\s+)?"([^"\s]+)"\s*$`)
+	jsImportRegex     = regexp.MustCompile(`(?:\bfrom\s*|\bimport\s*\(?\s*|\brequire\s*\(\s*)['"]([^'"]+)['"]`)
+	pythonImportRegex = regexp.MustCompile(`(?m)^\s*(?:from\s+(\.*[\w.]*)\s+import|import\s+([\w.]+))`)
+)
+
+// JavaScript and TypeScript extensions tried when resolving relative imports.
+var jsExts = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs"}
+
+// orderImportsFirst reorders entries so that files are emitted before the files that import them.
+// Among files that are not ordered by imports, the most imported files come first, then by path.
+// Imports are only resolved for Go, JavaScript/TypeScript, and Python; files in other languages
+// have no imports and fall back to path order. Files are read through the worker pool in batches
+// and only their imports are kept, so they are read again when their contents are emitted.
+func orderImportsFirst(ctx context.Context, entries []Entry) []Entry {
+	indexByPath := make(map[string]int)
+	for i, entry := range entries {
+		indexByPath[filepath.Clean(entry.Path)] = i
+	}
+
+	// Build the import graph
+	deps := make([][]int, len(entries))
+	importedBy := make([]int, len(entries))
+	goDirs := goPackageDirs(entries)
+	for start := 0; start < len(entries); start += readBatchSize {
+		batch := entries[start:min(start+readBatchSize, len(entries))]
+		files := readFiles(ctx, batch)
+		for j, entry := range batch {
+			// Files that exceed --max-file-size are skipped and have no imports
+			if files[j].TooLarge {
+				continue
+			}
+			if err := files[j].Err; err != nil {
+				slog.Debug("skipped unreadable file", slog.String("path", entry.Path), slog.String("error", err.Error()))
+				continue
+			}
+			i := start + j
+			seen := make(map[int]bool)
+			for _, dep := range resolveImports(entry.Path, string(files[j].Content), indexByPath, goDirs) {
+				if dep != i && !seen[dep] {
+					seen[dep] = true
+					deps[i] = append(deps[i], dep)
+					importedBy[dep]++
+				}
+			}
+		}
+	}
+
+	// Topologically sort the graph, visiting the most imported files first
+	less := func(a, b int) bool {
+		if importedBy[a] != importedBy[b] {
+			return importedBy[a] > importedBy[b]
+		}
+		return entries[a].Path < entries[b].Path
+	}
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return less(order[i], order[j]) })
+	visited := make([]bool, len(entries))
+	var ordered []Entry
+	var visit func(i int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		sort.Slice(deps[i], func(a, b int) bool { return less(deps[i][a], deps[i][b]) })
+		for _, dep := range deps[i] {
+			visit(dep)
+		}
+		ordered = append(ordered, entries[i])
+	}
+	for _, i := range order {
+		visit(i)
+	}
+	return ordered
+}
+
+// goPackageDirs returns the indexes of Go files grouped by their directory.
+func goPackageDirs(entries []Entry) map[string][]int {
+	dirs := make(map[string][]int)
+	for i, entry := range entries {
+		if filepath.Ext(entry.Path) == ".go" {
+			dir := filepath.Dir(filepath.Clean(entry.Path))
+			dirs[dir] = append(dirs[dir], i)
+		}
+	}
+	return dirs
+}
+
+// resolveImports returns the indexes of the entries imported by the file at path.
+func resolveImports(path, content string, indexByPath map[string]int, goDirs map[string][]int) []int {
+	var deps []int
+	dir := filepath.Dir(path)
+	switch filepath.Ext(path) {
+	case ".go":
+		// Imports precede all declarations, so only scan up to the first declaration
+		if loc := goDeclRegex.FindStringIndex(content); loc != nil {
+			content = content[:loc[0]]
+		}
+		for _, match := range goImportRegex.FindAllStringSubmatch(content, -1) {
+			deps = append(deps, resolveGoImport(match[1], dir, goDirs)...)
+		}
+	case ".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs":
+		for _, match := range jsImportRegex.FindAllStringSubmatch(content, -1) {
+			if !strings.HasPrefix(match[1], ".") {
+				continue // Package imports are outside the matched files
+			}
+			base := filepath.Join(dir, match[1])
+			candidates := []string{base}
+			for _, ext := range jsExts {
+				candidates = append(candidates, base+ext, filepath.Join(base, "index"+ext))
+			}
+			if i, ok := firstIndex(candidates, indexByPath); ok {
+				deps = append(deps, i)
+			}
+		}
+	case ".py":
+		for _, match := range pythonImportRegex.FindAllStringSubmatch(content, -1) {
+			module := match[1] + match[2]
+			// Leading dots are relative to the current package; otherwise try each ancestor directory
+			dots := len(module) - len(strings.TrimLeft(module, "."))
+			module = strings.ReplaceAll(strings.TrimLeft(module, "."), ".", string(os.PathSeparator))
+			var bases []string
+			if dots > 0 {
+				base := dir
+				for range dots - 1 {
+					base = filepath.Dir(base)
+				}
+				bases = append(bases, base)
+			} else {
+				for base := dir; ; base = filepath.Dir(base) {
+					bases = append(bases, base)
+					if base == filepath.Dir(base) {
+						break
+					}
+				}
+			}
+			for _, base := range bases {
+				modulePath := filepath.Join(base, module)
+				if i, ok := firstIndex([]string{modulePath + ".py", filepath.Join(modulePath, "__init__.py")}, indexByPath); ok {
+					deps = append(deps, i)
+					break
+				}
+			}
+		}
+	}
+	return deps
+}
+
+// resolveGoImport returns the indexes of the Go files in the package with the given import path.
+// The package directory is the one sharing the longest trailing path segments with the import path.
+func resolveGoImport(importPath, fromDir string, goDirs map[string][]int) []int {
+	importSegments := strings.Split(importPath, "/")
+	bestScore := 0
+	var best []int
+	for dir, indexes := range goDirs {
+		if dir == fromDir {
+			continue
+		}
+		dirSegments := strings.Split(filepath.ToSlash(dir), "/")
+		score := 0
+		for score < len(importSegments) && score < len(dirSegments) &&
+			importSegments[len(importSegments)-1-score] == dirSegments[len(dirSegments)-1-score] {
+			score++
+		}
+		if score > bestScore {
+			bestScore, best = score, indexes
+		} else if score == bestScore && score > 0 {
+			best = append(append([]int{}, best...), indexes...)
+		}
+	}
+	return best
+}
+
+// firstIndex returns the index of the first candidate path found in indexByPath.
+func firstIndex(candidates []string, indexByPath map[string]int) (int, bool) {
+	for _, candidate := range candidates {
+		if i, ok := indexByPath[filepath.Clean(candidate)]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestImportsFirst(t *testing.T) {
+	// A chain of imports spread over several read batches, each file importing the next
+	const files = readBatchSize*2 + 1
+	fixture := make(map[string]string)
+	var want []string
+	for i := range files {
+		path := fmt.Sprintf("f%03d.js", i)
+		content := "export const x = 1\n"
+		if i+1 < files {
+			content = fmt.Sprintf("import { x } from './f%03d'\n", i+1)
+		}
+		fixture[path] = content
+		want = append(want, path)
+	}
+	slices.Reverse(want)
+	dir := writeFixture(t, fixture)
+	if got := contentsPaths(t, dir, "--contents-ordering=imports-first", "--concurrency=3"); !slices.Equal(got, want) {
+		t.Errorf("contents = %q, want %q", got, want)
+	}
+}
+
+func TestImportsFirstUnreadable(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		"main.js": "import { x } from './util'\n",
+		"util.js": "export const x = 1\n",
+	})
+	missing := filepath.Join(dir, "missing.js")
+	entries := []Entry{
+		{Path: filepath.Join(dir, "main.js")},
+		{Path: missing},
+		{Path: filepath.Join(dir, "util.js")},
+	}
+	defer func(n int, files map[string]error) { concurrency, unreadableFiles = n, files }(concurrency, unreadableFiles)
+	concurrency = 2
+
+	// Read failures are recorded for --strict and the summary
+	unreadableFiles = make(map[string]error)
+	ordered := orderImportsFirst(context.Background(), entries)
+	if got := []string{ordered[0].Path, ordered[1].Path}; got[0] != entries[2].Path || got[1] != entries[0].Path {
+		t.Errorf("ordered = %q, want util.js before main.js", got)
+	}
+	if _, ok := unreadableFiles[missing]; !ok || len(unreadableFiles) != 1 {
+		t.Errorf("unreadableFiles = %v, want only %s", unreadableFiles, missing)
+	}
+
+	// Once cancelled, files are not read, so nothing is reordered or reported
+	unreadableFiles = make(map[string]error)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ordered = orderImportsFirst(ctx, entries)
+	if len(ordered) != len(entries) || len(unreadableFiles) != 0 {
+		t.Errorf("ordered %d entries with unreadableFiles = %v, want %d and none", len(ordered), unreadableFiles, len(entries))
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// DetailLevel describes one rendering strategy tried by --progressive-detail.
+type DetailLevel struct {
+	Name          string   // Name reported to the user
+	Formats       []Format // Formats to render, or nil to render the formats from --format
+	HeadTailLines int      // Number of lines to keep at the head and tail of each file, or 0 to keep all lines
+}
+
+// detailLevels are the rendering strategies for --progressive-detail, from the richest to the sparsest.
+var detailLevels = []DetailLevel{
+	{Name: "full"},
+	{Name: "head/tail (20 lines)", HeadTailLines: 20},
+	{Name: "head/tail (5 lines)", HeadTailLines: 5},
+	{Name: "tree and list", Formats: []Format{FormatTree, FormatList}},
+}
+
+// headTailLines is the number of lines kept at the head and tail of each file in the contents format.
+// It is set by --progressive-detail; 0 means all lines are kept.
+var headTailLines int
+
+// trimHeadTail keeps the first and last n lines of content, replacing the lines in between with a marker.
+// Content with at most 2n lines is returned unchanged.
+func trimHeadTail(content string, n int) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if n <= 0 || len(lines) <= 2*n {
+		return content
+	}
+	omitted := len(lines) - 2*n
+	head := strings.Join(lines[:n], "\n")
+	tail := strings.Join(lines[len(lines)-n:], "\n")
+	return fmt.Sprintf("%s\n[... %d lines omitted ...]\n%s\n", head, omitted, tail)
+}
+
+// renderProgressiveDetail renders each detail level in order and returns the output of the richest level
+// that fits within maxTokens, along with the level used. It returns an error if no level fits.
+func renderProgressiveDetail(ctx context.Context, entriesByRoot map[string][]Entry, parsedFormats []Format, parsedTreeStyle TreeStyle, maxTokens int) (string, DetailLevel, error) {
+	defer func() { headTailLines = 0 }()
+	var tokens int
+	for _, level := range detailLevels {
+		formats := level.Formats
+		if formats == nil {
+			formats = parsedFormats
+		}
+		headTailLines = level.HeadTailLines
+		output, err := renderFormats(ctx, entriesByRoot, formats, parsedTreeStyle)
+		if err != nil {
+			return "", DetailLevel{}, err
+		}
+		tokens = tokenizer.CountTokens(output)
+		if tokens <= maxTokens {
+			return output, level, nil
+		}
+	}
+	return "", DetailLevel{}, fmt.Errorf("output exceeds max tokens at every level of detail (~%s > %s tokens at the sparsest level)", humanize.Comma(int64(tokens)), humanize.Comma(int64(maxTokens)))
+}
@@ -0,0 +1,42 @@
+package main
+
+import "fmt"
+
+// PromptPosition represents where the --prompt text is placed relative to the output.
+type PromptPosition int
+
+const (
+	PromptPositionStart PromptPosition = iota // Position to prepend the prompt to the output
+	PromptPositionEnd                         // Position to append the prompt to the output
+)
+
+// PromptData is the data available to the --prompt and --prompt-file templates.
+type PromptData struct {
+	FileCount   int    // Number of files in the output
+	TotalTokens int    // Estimated tokens of the output, excluding the prompt
+	Tree        string // Directory tree of the files, as rendered by the tree format
+}
+
+// parsePromptPosition converts a single prompt position string to a PromptPosition enum.
+func parsePromptPosition(positionString string) (PromptPosition, error) {
+	switch positionString {
+	case "start":
+		return PromptPositionStart, nil
+	case "end":
+		return PromptPositionEnd, nil
+	default:
+		return 0, fmt.Errorf("invalid prompt position: %s", positionString)
+	}
+}
+
+// applyPrompt adds the rendered prompt to the output at --prompt-position, separated by a blank line.
+// The output is returned unchanged if the prompt is empty.
+func applyPrompt(prompt, output string) string {
+	if prompt == "" {
+		return output
+	}
+	if parsedPromptPosition == PromptPositionEnd {
+		return output + "\n\n" + prompt
+	}
+	return prompt + "\n\n" + output
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+)
+
+// readBatchSize is the number of files read at a time while rendering, which bounds the contents held in memory.
+const readBatchSize = 64
+
+// unreadableFiles records the files that failed to read during the run, with their errors, so they are summarized
+// once at the end (or fail the run with --strict) however many formats read them.
+var unreadableFiles = make(map[string]error)
+
+// FileContent is the result of reading the file of an entry.
+type FileContent struct {
+	Content  []byte // Contents of the file, or nil if the file was not read
+	Err      error  // Error from reading the file, if any
+	TooLarge bool   // Whether the file exceeds --max-file-size and was not read
+}
+
+// readFiles reads the files of entries with a bounded pool of --concurrency workers.
+// The results are in the same order as entries, so output assembly stays deterministic.
+// Files that exceed --max-file-size are not read.
+// Once ctx is cancelled, the remaining files are not read and their results hold the context's error.
+func readFiles(ctx context.Context, entries []Entry) []FileContent {
+	results := make([]FileContent, len(entries))
+	workers := concurrency
+	if workers > len(entries) {
+		workers = len(entries)
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				entry := entries[i]
+				if err := ctx.Err(); err != nil {
+					results[i] = FileContent{Err: err}
+					continue
+				}
+				if maxFileSizeBytes > 0 && uint64(entry.Size) > maxFileSizeBytes {
+					results[i] = FileContent{TooLarge: true}
+					continue
+				}
+				content, err := os.ReadFile(entry.Path)
+				results[i] = FileContent{Content: content, Err: err}
+			}
+		}()
+	}
+	for i := range entries {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	for i, result := range results {
+		if result.Err != nil && ctx.Err() == nil {
+			unreadableFiles[entries[i].Path] = result.Err
+		}
+	}
+	return results
+}
+
+// checkUnreadableFiles returns an error with --strict if any file failed to read during the run.
+func checkUnreadableFiles() error {
+	if !strict || len(unreadableFiles) == 0 {
+		return nil
+	}
+	paths := slices.Sorted(maps.Keys(unreadableFiles))
+	return fmt.Errorf("failed to read %s files, first %s: %w", humanize.Comma(int64(len(paths))), paths[0], unreadableFiles[paths[0]])
+}
+
+// printSkippedPaths prints how many paths were skipped due to errors while walking and reading, if any,
+// since each of them is only logged at the debug level.
+func printSkippedPaths() {
+	if skipped := len(lastWalkStats.Errors) + len(unreadableFiles); skipped > 0 {
+		fmt.Fprintln(os.Stderr, StyleBoldRed.Render(fmt.Sprintf("Skipped %s paths due to errors; rerun with --strict to fail, or --log-level=debug to list them", humanize.Comma(int64(skipped)))))
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// BenchmarkReadFiles reads a temporary tree of 512 files of 16KB with different numbers of workers (--concurrency).
+func BenchmarkReadFiles(b *testing.B) {
+	dir := b.TempDir()
+	content := []byte(strings.Repeat("x", 16*1024))
+	var entries []Entry
+	for i := range 512 {
+		path := filepath.Join(dir, fmt.Sprintf("dir%d", i%16), fmt.Sprintf("file%d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			b.Fatal(err)
+		}
+		entries = append(entries, Entry{Path: path, Size: int64(len(content))})
+	}
+	defer func(n int) { concurrency = n }(concurrency)
+	for _, workers := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("concurrency=%d", workers), func(b *testing.B) {
+			concurrency = workers
+			b.SetBytes(int64(len(entries) * len(content)))
+			for range b.N {
+				for _, result := range readFiles(context.Background(), entries) {
+					if result.Err != nil {
+						b.Fatal(result.Err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// redactedText replaces each secret found by --redact.
+const redactedText = "[REDACTED]"
+
+// defaultRedactPatterns are the regular expressions of common secrets that --redact replaces, unless overridden by
+// --redact-pattern. If a pattern has a capturing group, only the first group is replaced, so the surrounding
+// context (such as the variable name) is kept.
+var defaultRedactPatterns = []string{
+	// AWS access key IDs
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	// GitHub tokens
+	`\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+	// Bearer tokens in authorization headers
+	`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{8,}=*)`,
+	// PEM private keys, from the header to the footer
+	`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`,
+	// Assignments of keys, secrets, tokens, and passwords in .env files and shell scripts, e.g. API_KEY=...
+	`(?m)^\s*(?:export\s+)?[A-Z0-9_]*(?:KEY|SECRET|TOKEN|PASSWORD|PASSWD)[A-Z0-9_]*\s*=\s*["']?([^\s"'#]+)`,
+}
+
+// isEnvFile returns true if the file looks like a .env file (e.g., .env, .env.local, prod.env, .envrc),
+// which is redacted even without --redact.
+func isEnvFile(path string) bool {
+	name := filepath.Base(path)
+	return name == ".env" || name == ".envrc" || strings.HasPrefix(name, ".env.") || strings.HasSuffix(name, ".env")
+}
+
+// shouldRedact returns true if secrets in the file are redacted: every file with --redact (or --redact-pattern),
+// and .env-like files unless --redact=false is passed.
+func shouldRedact(path string) bool {
+	return redactAllFiles || redactEnvFiles && isEnvFile(path)
+}
+
+// redactContent replaces the secrets in the content of the file with [REDACTED] if shouldRedact(path),
+// and returns the content unchanged otherwise.
+func redactContent(path, content string) string {
+	if !shouldRedact(path) {
+		return content
+	}
+	for _, re := range parsedRedactRegexes {
+		content = redactMatches(re, content)
+	}
+	return content
+}
+
+// redactMatches replaces the matches of re in content with [REDACTED], or only the first capturing group of each
+// match if re has one.
+func redactMatches(re *regexp.Regexp, content string) string {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllLiteralString(content, redactedText)
+	}
+	var b strings.Builder
+	last := 0
+	for _, match := range re.FindAllStringSubmatchIndex(content, -1) {
+		if match[2] == -1 {
+			continue
+		}
+		b.WriteString(content[last:match[2]])
+		b.WriteString(redactedText)
+		last = match[3]
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
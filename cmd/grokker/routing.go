@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Route sends the output of a format to an action (e.g., --route tree=print).
+type Route struct {
+	Format Format
+	Action Action
+}
+
+// parseRoute converts a single route string of the form format=action to a Route.
+func parseRoute(routeString string) (Route, error) {
+	formatString, actionString, ok := strings.Cut(routeString, "=")
+	if !ok {
+		return Route{}, fmt.Errorf("invalid route: %s", routeString)
+	}
+	format, err := parseFormat(formatString)
+	if err != nil {
+		return Route{}, fmt.Errorf("invalid route: %s", routeString)
+	}
+	action, err := parseAction(actionString)
+	if err != nil {
+		return Route{}, fmt.Errorf("invalid route: %s", routeString)
+	}
+	return Route{Format: format, Action: action}, nil
+}
+
+// routedFormats returns the distinct formats of the routes, in the order they first appear.
+func routedFormats(routes []Route) []Format {
+	var formats []Format
+	for _, route := range routes {
+		if !slices.Contains(formats, route.Format) {
+			formats = append(formats, route.Format)
+		}
+	}
+	return formats
+}
+
+// routedActions returns the distinct actions of the routes, in the order they first appear.
+func routedActions(routes []Route) []Action {
+	var actions []Action
+	for _, route := range routes {
+		if !slices.Contains(actions, route.Action) {
+			actions = append(actions, route.Action)
+		}
+	}
+	return actions
+}
+
+// formatsRoutedTo returns the distinct formats routed to the action, in the order they first appear.
+func formatsRoutedTo(routes []Route, action Action) []Format {
+	var formats []Format
+	for _, route := range routes {
+		if route.Action == action && !slices.Contains(formats, route.Format) {
+			formats = append(formats, route.Format)
+		}
+	}
+	return formats
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// signaturePrinter prints declarations the way gofmt does, aligning struct fields with spaces.
+var signaturePrinter = printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+
+// goSignatures returns the shape of a Go file: its package clause, imports, type declarations,
+// and function and method signatures with bodies elided as { ... }. Doc comments are kept for
+// the package and for exported identifiers. Non-Go files, and Go files that fail to parse,
+// are returned unchanged.
+func goSignatures(path string, content []byte) string {
+	if filepath.Ext(path) != ".go" {
+		return string(content)
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, content, parser.ParseComments)
+	if err != nil {
+		return string(content)
+	}
+	var decls []ast.Node
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if decl.Tok != token.IMPORT && decl.Tok != token.TYPE {
+				continue
+			}
+			gen := *decl
+			if !hasExportedSpec(&gen) {
+				gen.Doc = nil
+			}
+			decls = append(decls, &gen)
+		case *ast.FuncDecl:
+			fn := *decl
+			fn.Body = nil
+			if !fn.Name.IsExported() {
+				fn.Doc = nil
+			}
+			decls = append(decls, &fn)
+		}
+	}
+
+	var b strings.Builder
+	if file.Doc != nil {
+		b.WriteString(formatCommentGroup(file.Doc))
+	}
+	b.WriteString("package " + file.Name.Name + "\n")
+	for _, decl := range decls {
+		var buf bytes.Buffer
+		if err := signaturePrinter.Fprint(&buf, fset, decl); err != nil {
+			return string(content)
+		}
+		b.WriteString("\n" + buf.String())
+		if _, ok := decl.(*ast.FuncDecl); ok {
+			b.WriteString(" { ... }")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// hasExportedSpec returns true if the declaration is an import or declares an exported type.
+func hasExportedSpec(decl *ast.GenDecl) bool {
+	for _, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.ImportSpec:
+			return true
+		case *ast.TypeSpec:
+			if spec.Name.IsExported() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// formatCommentGroup formats the comments of the group as they appear in the source, one per line.
+func formatCommentGroup(group *ast.CommentGroup) string {
+	var b strings.Builder
+	for _, comment := range group.List {
+		b.WriteString(comment.Text + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// SortOrder represents the possible orderings of files within each format.
+type SortOrder int
+
+const (
+	SortName     SortOrder = iota // Order to sort files alphabetically by path
+	SortModified                  // Order to sort the most recently modified files first
+	SortSize                      // Order to sort the largest files first
+	SortNone                      // Order to keep files in walk order
+	SortExt                       // Order to group files by extension, then sort them by path
+)
+
+// sortEntries sorts entries in place according to order, reversed with --reverse.
+// Ties are broken by path so the output is deterministic.
+func sortEntries(entries []Entry, order SortOrder) {
+	if reverseSort {
+		defer slices.Reverse(entries)
+	}
+	switch order {
+	case SortName:
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	case SortModified:
+		sort.SliceStable(entries, func(i, j int) bool {
+			if !entries[i].ModTime.Equal(entries[j].ModTime) {
+				return entries[i].ModTime.After(entries[j].ModTime)
+			}
+			return entries[i].Path < entries[j].Path
+		})
+	case SortSize:
+		sort.SliceStable(entries, func(i, j int) bool {
+			if entries[i].Size != entries[j].Size {
+				return entries[i].Size > entries[j].Size
+			}
+			return entries[i].Path < entries[j].Path
+		})
+	case SortExt:
+		sort.SliceStable(entries, func(i, j int) bool {
+			if extI, extJ := filepath.Ext(entries[i].Path), filepath.Ext(entries[j].Path); extI != extJ {
+				return extI < extJ
+			}
+			return entries[i].Path < entries[j].Path
+		})
+	}
+}
+
+// sortedRoots returns the roots of entriesByRoot in sorted order, so output does not depend on map iteration order.
+func sortedRoots(entriesByRoot map[string][]Entry) []string {
+	roots := make([]string, 0, len(entriesByRoot))
+	for root := range entriesByRoot {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// flattenEntries returns the entries of all roots, ordered by root.
+func flattenEntries(entriesByRoot map[string][]Entry) []Entry {
+	var flattened []Entry
+	for _, root := range sortedRoots(entriesByRoot) {
+		flattened = append(flattened, entriesByRoot[root]...)
+	}
+	return flattened
+}
+
+// isReadme returns true if the file name begins with "README", ignoring case (e.g., README.md, readme.txt).
+func isReadme(path string) bool {
+	return strings.HasPrefix(strings.ToUpper(filepath.Base(path)), "README")
+}
+
+// floatReadmes returns the entries with each directory's README files moved
+// directly before the first other file of that directory. The relative order
+// of all other entries is preserved.
+func floatReadmes(entries []Entry) []Entry {
+	readmesByDir := make(map[string][]Entry)
+	for _, entry := range entries {
+		if isReadme(entry.Path) {
+			dir := filepath.Dir(entry.Path)
+			readmesByDir[dir] = append(readmesByDir[dir], entry)
+		}
+	}
+	ordered := make([]Entry, 0, len(entries))
+	emitted := make(map[string]bool)
+	for _, entry := range entries {
+		dir := filepath.Dir(entry.Path)
+		if !emitted[dir] {
+			emitted[dir] = true
+			ordered = append(ordered, readmesByDir[dir]...)
+		}
+		if !isReadme(entry.Path) {
+			ordered = append(ordered, entry)
+		}
+	}
+	return ordered
+}
+
+// orderFromManifest returns the entries with the paths listed in manifest first, in the order listed,
+// followed by the unlisted entries in their existing order.
+func orderFromManifest(entries []Entry, manifest []string) []Entry {
+	entriesByPath := make(map[string]Entry)
+	for _, entry := range entries {
+		entriesByPath[filepath.Clean(entry.Path)] = entry
+	}
+	ordered := make([]Entry, 0, len(entries))
+	listed := make(map[string]bool)
+	for _, path := range manifest {
+		if entry, ok := entriesByPath[path]; ok && !listed[path] {
+			listed[path] = true
+			ordered = append(ordered, entry)
+		}
+	}
+	for _, entry := range entries {
+		if !listed[filepath.Clean(entry.Path)] {
+			ordered = append(ordered, entry)
+		}
+	}
+	return ordered
+}
+
+// readManifest reads the paths listed in the file at path, one per line.
+// Blank lines and lines beginning with # are ignored, and paths are cleaned (e.g., ./a.go becomes a.go).
+func readManifest(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, filepath.Clean(line))
+	}
+	return paths, nil
+}
+
+// omitEntries returns entriesByRoot without the omitted entries.
+func omitEntries(entriesByRoot map[string][]Entry, omitted []Entry) map[string][]Entry {
+	omittedPaths := make(map[string]bool)
+	for _, entry := range omitted {
+		omittedPaths[entry.Path] = true
+	}
+	remaining := make(map[string][]Entry)
+	for root, entries := range entriesByRoot {
+		for _, entry := range entries {
+			if !omittedPaths[entry.Path] {
+				remaining[root] = append(remaining[root], entry)
+			}
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// unsafeFileNameRegex matches runs of characters that are not safe in file names on common filesystems.
+var unsafeFileNameRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// sanitizeFileName converts a root directory into a safe file name component, e.g. "apps/web" to "apps_web".
+// Roots without a usable name, such as "." or "/", become "root".
+func sanitizeFileName(root string) string {
+	name := unsafeFileNameRegex.ReplaceAllString(filepath.ToSlash(filepath.Clean(root)), "_")
+	name = strings.Trim(name, "._")
+	if name == "" {
+		return "root"
+	}
+	return name
+}
+
+// splitOutputPath returns the --output path for a single root with --split-by-root, e.g. out.txt to out-apps_web.txt.
+// The extension of output is kept, or .txt is used if it has none. Names already in use get a numeric suffix
+// so roots that sanitize to the same name do not overwrite each other.
+func splitOutputPath(output, root string, used map[string]bool) string {
+	ext := filepath.Ext(output)
+	base := strings.TrimSuffix(output, ext)
+	if ext == "" {
+		ext = ".txt"
+	}
+	name := sanitizeFileName(root)
+	path := base + "-" + name + ext
+	for i := 2; used[path]; i++ {
+		path = base + "-" + name + "-" + strconv.Itoa(i) + ext
+	}
+	used[path] = true
+	return path
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// lastWalkStats records what the most recent walk skipped, so the stats format can report it.
+var lastWalkStats WalkStats
+
+// ExtStats aggregates the files of a single extension in the stats format.
+type ExtStats struct {
+	Ext   string
+	Files int
+	Bytes int64
+}
+
+// FileStats is a row of the per-file table in the stats format. Lines is -1 for files whose lines are not counted.
+type FileStats struct {
+	Entry Entry
+	Ext   string
+	Lines int
+}
+
+// renderStats renders an overview of the files: the number of files, total bytes, lines, and estimated tokens,
+// a breakdown per extension sorted by bytes, and the number of files skipped by the walk and by binary detection.
+// With perFile, a table of the path, lines, bytes, extension, and modification time of each file follows the totals,
+// sorted by --sort-by. Lines are only counted for text files that were read; binary files and files over
+// --max-file-size count toward bytes.
+func renderStats(ctx context.Context, entriesByRoot map[string][]Entry, perFile bool) string {
+	statsEntries := flattenEntries(entriesByRoot)
+	sortEntries(statsEntries, parsedSortOrder)
+	statsFiles := readFiles(ctx, statsEntries)
+	var totalLines, binaryFiles int
+	var totalBytes int64
+	byExt := make(map[string]*ExtStats)
+	var fileStats []FileStats
+	for i, entry := range statsEntries {
+		if statsFiles[i].Err != nil {
+			slog.Debug("skipped unreadable file", slog.String("path", entry.Path), slog.String("error", statsFiles[i].Err.Error()))
+			continue
+		}
+		ext := filepath.Ext(entry.Path)
+		if ext == "" {
+			ext = "(none)"
+		}
+		if byExt[ext] == nil {
+			byExt[ext] = &ExtStats{Ext: ext}
+		}
+		byExt[ext].Files++
+		byExt[ext].Bytes += entry.Size
+		totalBytes += entry.Size
+		fileStats = append(fileStats, FileStats{Entry: entry, Ext: ext, Lines: -1})
+		if statsFiles[i].TooLarge {
+			continue
+		}
+		if isBinary(statsFiles[i].Content) {
+			binaryFiles++
+			continue
+		}
+		fileStats[len(fileStats)-1].Lines = countLines(statsFiles[i].Content)
+		totalLines += countLines(statsFiles[i].Content)
+	}
+
+	extStats := make([]*ExtStats, 0, len(byExt))
+	for _, stats := range byExt {
+		extStats = append(extStats, stats)
+	}
+	sort.Slice(extStats, func(i, j int) bool {
+		if extStats[i].Bytes != extStats[j].Bytes {
+			return extStats[i].Bytes > extStats[j].Bytes
+		}
+		return extStats[i].Ext < extStats[j].Ext
+	})
+	var extRows [][]string
+	var totalFiles int
+	for _, stats := range extStats {
+		share := 0.0
+		if totalBytes > 0 {
+			share = float64(stats.Bytes) / float64(totalBytes) * 100
+		}
+		extRows = append(extRows, []string{stats.Ext, humanize.Comma(int64(stats.Files)), humanize.Bytes(uint64(stats.Bytes)), fmt.Sprintf("%.1f%%", share)})
+		totalFiles += stats.Files
+	}
+
+	var b strings.Builder
+	b.WriteString(renderTable(nil, [][]string{
+		{"files", humanize.Comma(int64(totalFiles))},
+		{"bytes", humanize.Bytes(uint64(totalBytes))},
+		{"lines", humanize.Comma(int64(totalLines))},
+		{"tokens", "~" + humanize.Comma(estimateTokens(totalBytes))},
+	}))
+	b.WriteString("\n")
+	if perFile {
+		sortFileStats(fileStats, parsedStatsSortKey)
+		var fileRows [][]string
+		for _, stats := range fileStats {
+			lines := "-"
+			if stats.Lines >= 0 {
+				lines = humanize.Comma(int64(stats.Lines))
+			}
+			fileRows = append(fileRows, []string{stats.Entry.Path, lines, humanize.Bytes(uint64(stats.Entry.Size)), stats.Ext, stats.Entry.ModTime.Format("2006-01-02 15:04")})
+		}
+		b.WriteString(renderTable([]string{"path", "lines", "bytes", "ext", "modified"}, fileRows))
+		b.WriteString("\n")
+	}
+	b.WriteString(renderTable([]string{"ext", "files", "bytes", "share"}, extRows))
+	b.WriteString("\n")
+	b.WriteString(renderTable([]string{"skipped", "count"}, [][]string{
+		{"ignored directories", humanize.Comma(int64(len(lastWalkStats.IgnoredDirs)))},
+		{"files over max-size", humanize.Comma(int64(lastWalkStats.TooLarge))},
+		{"files under min-size", humanize.Comma(int64(lastWalkStats.TooSmall))},
+		{"binary files", humanize.Comma(int64(binaryFiles))},
+	}))
+	return b.String()
+}
+
+// StatsSortKey represents the possible orderings of the per-file table in the stats format.
+type StatsSortKey int
+
+const (
+	StatsSortDefault StatsSortKey = iota // Order to keep the --sort order
+	StatsSortName                        // Order to sort files alphabetically by path
+	StatsSortSize                        // Order to sort the largest files first
+	StatsSortLines                       // Order to sort the files with the most lines first
+	StatsSortModTime                     // Order to sort the most recently modified files first
+)
+
+// parseStatsSortKey converts a single --sort-by string to a StatsSortKey enum.
+func parseStatsSortKey(keyString string) (StatsSortKey, error) {
+	switch keyString {
+	case "":
+		return StatsSortDefault, nil
+	case "name":
+		return StatsSortName, nil
+	case "size":
+		return StatsSortSize, nil
+	case "lines":
+		return StatsSortLines, nil
+	case "modtime":
+		return StatsSortModTime, nil
+	default:
+		return 0, fmt.Errorf("invalid sort key: %s", keyString)
+	}
+}
+
+// sortFileStats sorts the rows of the per-file table in place according to key.
+// Ties are broken by path so the output is deterministic, and the default keeps the --sort order of the rows.
+func sortFileStats(stats []FileStats, key StatsSortKey) {
+	if key == StatsSortDefault {
+		return
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		switch {
+		case key == StatsSortSize && a.Entry.Size != b.Entry.Size:
+			return a.Entry.Size > b.Entry.Size
+		case key == StatsSortLines && a.Lines != b.Lines:
+			return a.Lines > b.Lines
+		case key == StatsSortModTime && !a.Entry.ModTime.Equal(b.Entry.ModTime):
+			return a.Entry.ModTime.After(b.Entry.ModTime)
+		}
+		return a.Entry.Path < b.Entry.Path
+	})
+}
+
+// StatsMode represents where --stats writes the summary of the files.
+type StatsMode int
+
+const (
+	StatsNone   StatsMode = iota // Mode to not summarize the files
+	StatsStderr                  // Mode to write the summary to stderr after the output
+	StatsAppend                  // Mode to append the summary to the output, after --format-separator
+)
+
+// parseStatsMode converts a single stats mode string to a StatsMode enum.
+func parseStatsMode(modeString string) (StatsMode, error) {
+	switch modeString {
+	case "":
+		return StatsNone, nil
+	case "stderr":
+		return StatsStderr, nil
+	case "append":
+		return StatsAppend, nil
+	default:
+		return 0, fmt.Errorf("invalid stats mode: %s", modeString)
+	}
+}
+
+// statsDivider separates the summary of the files from the output with --stats=append.
+const statsDivider = "---"
+
+// appendStats appends the summary of the files to output with --stats=append, after a --- divider surrounded by
+// --format-separator, so the summary is easy to tell apart from the contents. The output is returned unchanged otherwise.
+func appendStats(ctx context.Context, output string, entriesByRoot map[string][]Entry) string {
+	if parsedStatsMode != StatsAppend {
+		return output
+	}
+	return output + parsedFormatSeparator + statsDivider + parsedFormatSeparator + strings.TrimSpace(renderStats(ctx, entriesByRoot, false))
+}
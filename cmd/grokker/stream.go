@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"unicode/utf8"
+)
+
+// streamBufferSize is the size of the buffer between the formats and stdout or the --output file.
+const streamBufferSize = 64 * 1024
+
+// errWriter is a writer that stops writing after the first error, so a format can write many pieces
+// and check for an error once at the end.
+type errWriter struct {
+	w   io.Writer
+	err error // First error returned by w
+}
+
+// Write writes p to the underlying writer unless a previous write failed.
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
+}
+
+// newlineNormalizer is a streaming writer that trims leading and trailing whitespace and collapses three or more
+// consecutive newlines into two, the same as threeOrMoreNewlinesRegex and strings.TrimSpace over the whole output.
+// Whitespace is held back until it is followed by something else, so trailing whitespace is never written.
+type newlineNormalizer struct {
+	w       io.Writer
+	started bool   // Whether anything other than whitespace has been written
+	pending []byte // Whitespace not yet written
+}
+
+// isSpaceByte returns true if b is ASCII whitespace.
+func isSpaceByte(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+// Write writes p to the underlying writer, holding back any whitespace at its end.
+func (n *newlineNormalizer) Write(p []byte) (int, error) {
+	for i := 0; i < len(p); {
+		j := i
+		if isSpaceByte(p[i]) {
+			for j < len(p) && isSpaceByte(p[j]) {
+				j++
+			}
+			n.pending = append(n.pending, p[i:j]...)
+			i = j
+			continue
+		}
+		for j < len(p) && !isSpaceByte(p[j]) {
+			j++
+		}
+		if n.started && len(n.pending) > 0 {
+			if _, err := n.w.Write(threeOrMoreNewlinesRegex.ReplaceAll(n.pending, []byte("\n\n"))); err != nil {
+				return i, err
+			}
+		}
+		n.pending = n.pending[:0]
+		if _, err := n.w.Write(p[i:j]); err != nil {
+			return i, err
+		}
+		n.started = true
+		i = j
+	}
+	return len(p), nil
+}
+
+// validUTF8Writer is a streaming writer that replaces invalid UTF-8 with the Unicode replacement character,
+// the same as ensureValidUTF8 with --on-invalid-utf8=replace. A rune split across writes is held back until it is complete.
+type validUTF8Writer struct {
+	w       io.Writer
+	pending []byte // Start of a rune that may be completed by the next write
+}
+
+// Write writes p to the underlying writer with invalid UTF-8 replaced.
+func (v *validUTF8Writer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(v.pending) > 0 {
+		p = append(v.pending, p...)
+		v.pending = nil
+	}
+	cut := len(p)
+	for i := len(p) - 1; i >= 0 && i > len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	v.pending = bytes.Clone(p[cut:])
+	if _, err := v.w.Write(bytes.ToValidUTF8(p[:cut], []byte(string(utf8.RuneError)))); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Flush writes any incomplete rune held back, replaced since no write can complete it anymore.
+func (v *validUTF8Writer) Flush() error {
+	if len(v.pending) == 0 {
+		return nil
+	}
+	_, err := v.w.Write(bytes.ToValidUTF8(v.pending, []byte(string(utf8.RuneError))))
+	v.pending = nil
+	return err
+}
+
+// countingWriter is a writer that counts the bytes written and remembers the last one.
+type countingWriter struct {
+	w    io.Writer
+	n    int64 // Number of bytes written
+	last byte  // Last byte written
+}
+
+// Write writes p to the underlying writer and counts it.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if n > 0 {
+		c.last = p[n-1]
+	}
+	return n, err
+}
+
+// canStream returns true if the output can be written to stdout and --output as it is rendered.
+// Anything that needs the whole output at once is rendered into memory instead: the copy and save actions, --max-tokens,
+// --prompt and --prompt-file, --route, --split-by-root, --on-invalid-utf8=error and --strict (which must reject the output
+// before any of it is written), and printing while also writing --output to stdout.
+func canStream(parsedActions []Action) bool {
+	policy, _ := parseInvalidUTF8Policy(onInvalidUTF8)
+	return !slices.Contains(parsedActions, ActionCopy) &&
+		!slices.Contains(parsedActions, ActionSave) &&
+		maxTokens == 0 &&
+		parsedPrompt == nil &&
+		len(parsedRoutes) == 0 &&
+		!splitByRoot &&
+		policy != InvalidUTF8Error &&
+		!strict &&
+		!(output == "-" && slices.Contains(parsedActions, ActionPrint))
+}
+
+// streamOutput writes the formats to stdout (with the print action) and the --output file as they are rendered,
+// so memory stays roughly constant however large the output is. Like the print action and --output,
+// the output ends with a newline unless it ends with NUL-terminated paths (--format=paths0).
+// It returns the estimated number of tokens in the output, which is based on its size since the output is never held in full.
+func streamOutput(ctx context.Context, entriesByRoot map[string][]Entry, parsedActions []Action, parsedFormats []Format, parsedTreeStyle TreeStyle) (int64, error) {
+	var writers []io.Writer
+	if slices.Contains(parsedActions, ActionPrint) || output == "-" {
+		writers = append(writers, os.Stdout)
+	}
+	var file *os.File
+	if output != "" && output != "-" {
+		var err error
+		file, err = openOutput(output, force)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+		writers = append(writers, file)
+	}
+	bw := bufio.NewWriterSize(io.MultiWriter(writers...), streamBufferSize)
+	var utf8w *validUTF8Writer
+	var w io.Writer = bw
+	if policy, _ := parseInvalidUTF8Policy(onInvalidUTF8); policy == InvalidUTF8Replace {
+		utf8w = &validUTF8Writer{w: bw}
+		w = utf8w
+	}
+	cw := &countingWriter{w: w}
+	io.WriteString(cw, parsedPrefix)
+	if err := writeFormats(ctx, cw, entriesByRoot, parsedFormats, parsedTreeStyle); err != nil {
+		return 0, err
+	}
+	io.WriteString(cw, appendStats(ctx, "", entriesByRoot)+parsedSuffix)
+	if utf8w != nil {
+		if err := utf8w.Flush(); err != nil {
+			return 0, fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	if cw.last != 0 || cw.n == 0 {
+		bw.WriteString("\n")
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to write output: %w", err)
+	}
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return 0, fmt.Errorf("failed to write output file: %w", err)
+		}
+	}
+	return estimateTokens(cw.n), nil
+}
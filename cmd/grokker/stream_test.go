@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestValidUTF8Writer(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"valid", []string{"héllo"}, "héllo"},
+		{"invalid byte", []string{"a\xffb"}, "a�b"},
+		{"two-byte rune split across writes", []string{"caf\xc3", "\xa9!"}, "café!"},
+		{"four-byte rune split across three writes", []string{"\xf0\x9f", "\x98", "\x80"}, "😀"},
+		{"incomplete rune at the end", []string{"ok\xe2\x82"}, "ok�"},
+		// Like ensureValidUTF8, a run of invalid bytes is replaced by a single replacement character
+		{"split rune followed by an invalid byte", []string{"\xc3", "\xff"}, "�"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			w := &validUTF8Writer{w: &b}
+			for _, p := range tt.writes {
+				n, err := w.Write([]byte(p))
+				if err != nil || n != len(p) {
+					t.Fatalf("Write(%q) = %d, %v, want %d, nil", p, n, err, len(p))
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
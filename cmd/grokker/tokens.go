@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Tokenizer estimates the number of LLM tokens in a piece of text.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// HeuristicTokenizer estimates tokens using the common heuristic of roughly 4 characters per token.
+// It is not exact for any particular model, but is close enough to budget context windows.
+type HeuristicTokenizer struct{}
+
+// CountTokens returns the estimated number of tokens in text.
+func (HeuristicTokenizer) CountTokens(text string) int {
+	return int(estimateTokens(int64(len(text))))
+}
+
+// tokenizer is the Tokenizer used to estimate token counts.
+var tokenizer Tokenizer = HeuristicTokenizer{}
+
+// estimateTokens estimates the number of LLM tokens for the given number of bytes.
+// It is used when only the file size is known, before the file has been read.
+func estimateTokens(bytes int64) int64 {
+	return (bytes + 3) / 4
+}
+
+// fitToTokenBudget renders the formats and, while the output exceeds maxTokens, drops the largest files first.
+// It returns the rendered output and the files that were omitted to fit the budget, or an error if the output
+// still exceeds the budget with every file omitted (e.g., the summary format alone is too large).
+func fitToTokenBudget(ctx context.Context, entriesByRoot map[string][]Entry, parsedFormats []Format, parsedTreeStyle TreeStyle, maxTokens int) (string, []Entry, error) {
+	candidates := flattenEntries(entriesByRoot)
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Size > candidates[j].Size })
+
+	var omittedEntries []Entry
+	for {
+		output, err := renderFormats(ctx, omitEntries(entriesByRoot, omittedEntries), parsedFormats, parsedTreeStyle)
+		if err != nil {
+			return "", nil, err
+		}
+		overage := tokenizer.CountTokens(output) - maxTokens
+		if overage <= 0 {
+			return output, omittedEntries, nil
+		}
+		if len(omittedEntries) == len(candidates) {
+			return "", nil, fmt.Errorf("output exceeds max tokens by ~%s tokens even with every file omitted (~%s > %s); raise --max-tokens or pass fewer --format values",
+				humanize.Comma(int64(overage)), humanize.Comma(int64(overage+maxTokens)), humanize.Comma(int64(maxTokens)))
+		}
+
+		// Omit the largest remaining files until their estimated tokens cover the overage
+		var covered int64
+		for _, entry := range candidates[len(omittedEntries):] {
+			if covered >= int64(overage) {
+				break
+			}
+			omittedEntries = append(omittedEntries, entry)
+			covered += estimateTokens(entry.Size)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncateOverBudget(t *testing.T) {
+	dir := writeFixture(t, map[string]string{"big.txt": strings.Repeat("x", 400) + "\n", "small.txt": "hi\n"})
+
+	// Dropping the largest file fits the budget
+	stdout, stderr, err := runGrokker(t, dir, "", "-y", "--action=print", "--format=contents", "--max-tokens=40", "--truncate")
+	if err != nil {
+		t.Fatalf("grokker failed: %v\n%s", err, stderr)
+	}
+	if strings.Contains(stdout, "big.txt") || !strings.Contains(stdout, "small.txt") {
+		t.Errorf("expected only big.txt to be omitted, got stdout %q, stderr %q", stdout, stderr)
+	}
+
+	// The summary format is over budget even with every file omitted, which must fail rather than exceed the budget
+	stdout, stderr, err = runGrokker(t, dir, "", "-y", "--action=print", "--format=summary", "--max-tokens=1", "--truncate")
+	if err == nil {
+		t.Fatalf("grokker succeeded over the budget, want an error\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "even with every file omitted") {
+		t.Errorf("stderr = %q, want the overage with every file omitted", stderr)
+	}
+}
+
+func TestTokenCountOnlyWithStats(t *testing.T) {
+	dir := writeFixture(t, depthFixture)
+	for _, args := range [][]string{{"--format=paths0"}, {"--format=list", "--stats=append"}} {
+		_, stderr, err := runGrokker(t, dir, "", append([]string{"-y", "--action=print"}, args...)...)
+		if err != nil {
+			t.Fatalf("grokker %s failed: %v\n%s", strings.Join(args, " "), err, stderr)
+		}
+		if stderr != "" {
+			t.Errorf("grokker %s wrote to stderr: %q", strings.Join(args, " "), stderr)
+		}
+	}
+	_, stderr, err := runGrokker(t, dir, "", "-y", "--action=print", "--format=list", "--stats")
+	if err != nil {
+		t.Fatalf("grokker --stats failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stderr, " tokens") {
+		t.Errorf("stderr = %q, want the estimated tokens with --stats", stderr)
+	}
+}
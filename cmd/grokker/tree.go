@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// TreeNode represents a node in the directory tree, with a flag to distinguish directories from files.
+// Lines, Bytes, and ModTime hold per-file metadata and are only meaningful for files.
+// Lines is -1 when the file was not read (e.g., it exceeds --max-file-size).
+type TreeNode struct {
+	IsDir    bool
+	Lines    int
+	Bytes    int64
+	ModTime  time.Time
+	Hint     string
+	Children map[string]*TreeNode
+}
+
+// TreeStyle represents the possible styles for rendering the tree.
+type TreeStyle int
+
+const (
+	TreeStylePlain   TreeStyle = iota // Style to indent each level by two spaces
+	TreeStyleUnicode                  // Style to draw branches with box-drawing connectors
+)
+
+// PrintOptions configures how Print renders the tree.
+type PrintOptions struct {
+	Style     TreeStyle // Style used to render branches
+	Sort      SortOrder // Order of siblings; SortNone falls back to SortName since the tree does not keep walk order
+	Reverse   bool      // Reverse the order of siblings, still listing directories before files
+	ShowStats bool      // Show line counts and byte sizes next to files and directories
+	MaxDepth  int       // Depth below which directories are collapsed; -1 means never collapse
+}
+
+// Insert adds a path into the tree structure, respecting whether it’s a file or directory.
+// It returns the node for the last part of the path, or nil if parts is empty.
+func Insert(node *TreeNode, parts []string, isDir bool) *TreeNode {
+	if len(parts) == 0 {
+		return nil
+	}
+	part := parts[0]
+	if _, ok := node.Children[part]; !ok {
+		// Intermediate parts are directories; last part uses isDir
+		node.Children[part] = &TreeNode{
+			IsDir:    len(parts) > 1 || isDir,
+			Children: make(map[string]*TreeNode),
+		}
+	}
+	if len(parts) > 1 {
+		return Insert(node.Children[part], parts[1:], isDir)
+	}
+	node.Children[part].IsDir = isDir
+	return node.Children[part]
+}
+
+// NewTree builds a tree of the entries' paths, recording the size and modification time of each file.
+// Paths shared by several entries (e.g., from overlapping directories) are inserted once.
+func NewTree(entries []Entry) *TreeNode {
+	root := &TreeNode{IsDir: true, Children: make(map[string]*TreeNode)}
+	for _, entry := range entries {
+		parts := strings.Split(filepath.Clean(entry.Path), string(os.PathSeparator))
+		leaf := Insert(root, parts, entry.IsDir)
+		leaf.Bytes = entry.Size
+		leaf.ModTime = entry.ModTime
+		leaf.Lines = -1
+	}
+	return root
+}
+
+// Merge deep-merges the tree other into node, so the files of several trees (e.g., one per --dir) can be shown in one hierarchy.
+// Nodes of other are copied, so node never shares children with other. Where both trees hold the same file,
+// the metadata from other wins, and where a path is a file in one tree and a directory in the other, other wins.
+func Merge(node, other *TreeNode) {
+	for key, otherChild := range other.Children {
+		child, ok := node.Children[key]
+		if !ok || child.IsDir != otherChild.IsDir || !otherChild.IsDir {
+			node.Children[key] = copyTree(otherChild)
+			continue
+		}
+		Merge(child, otherChild)
+	}
+}
+
+// copyTree returns a deep copy of the node and its children.
+func copyTree(node *TreeNode) *TreeNode {
+	clone := *node
+	clone.Children = make(map[string]*TreeNode, len(node.Children))
+	for key, child := range node.Children {
+		clone.Children[key] = copyTree(child)
+	}
+	return &clone
+}
+
+// Paths returns the paths of all files (leaf nodes) under the node, joined to prefix, in sorted order.
+// It reconstructs the paths inserted with NewTree or Insert without walking the filesystem again.
+func Paths(node *TreeNode, prefix string) []string {
+	var keys []string
+	for key := range node.Children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var paths []string
+	for _, key := range keys {
+		path := filepath.Join(prefix, key)
+		if key == "" {
+			// The empty first part of an absolute path
+			path = string(os.PathSeparator)
+		}
+		child := node.Children[key]
+		if child.IsDir {
+			paths = append(paths, Paths(child, path)...)
+		} else {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Count returns the number of files (leaf nodes) under the node.
+func Count(node *TreeNode) int {
+	if !node.IsDir {
+		return 1
+	}
+	count := 0
+	for _, child := range node.Children {
+		count += Count(child)
+	}
+	return count
+}
+
+// formatCollapsed formats the file count of a collapsed directory, e.g. " (12 files)".
+func formatCollapsed(node *TreeNode) string {
+	count := Count(node)
+	if count == 1 {
+		return " (1 file)"
+	}
+	return fmt.Sprintf(" (%s files)", humanize.Comma(int64(count)))
+}
+
+// Stats returns the aggregated line count and byte size of all files under the node.
+// Files whose line count is unknown contribute only their byte size.
+func Stats(node *TreeNode) (lines int, bytes int64) {
+	if !node.IsDir {
+		return max(node.Lines, 0), node.Bytes
+	}
+	for _, child := range node.Children {
+		childLines, childBytes := Stats(child)
+		lines += childLines
+		bytes += childBytes
+	}
+	return lines, bytes
+}
+
+// latestModTime returns the most recent modification time of all files under the node.
+func latestModTime(node *TreeNode) time.Time {
+	if !node.IsDir {
+		return node.ModTime
+	}
+	var latest time.Time
+	for _, child := range node.Children {
+		if modTime := latestModTime(child); modTime.After(latest) {
+			latest = modTime
+		}
+	}
+	return latest
+}
+
+// sortKeys sorts the children keys of the node according to order (reversed if reverse is true), with directories before files.
+// Directories are compared by their aggregated size or latest modification time, and have no extension.
+func sortKeys(node *TreeNode, keys []string, order SortOrder, reverse bool) {
+	defer sort.SliceStable(keys, func(i, j int) bool {
+		return node.Children[keys[i]].IsDir && !node.Children[keys[j]].IsDir
+	})
+	if reverse {
+		defer slices.Reverse(keys)
+	}
+	sort.Strings(keys)
+	switch order {
+	case SortExt:
+		sort.SliceStable(keys, func(i, j int) bool {
+			extI, extJ := "", ""
+			if !node.Children[keys[i]].IsDir {
+				extI = filepath.Ext(keys[i])
+			}
+			if !node.Children[keys[j]].IsDir {
+				extJ = filepath.Ext(keys[j])
+			}
+			return extI < extJ
+		})
+	case SortModified:
+		sort.SliceStable(keys, func(i, j int) bool {
+			return latestModTime(node.Children[keys[i]]).After(latestModTime(node.Children[keys[j]]))
+		})
+	case SortSize:
+		sort.SliceStable(keys, func(i, j int) bool {
+			_, bytesI := Stats(node.Children[keys[i]])
+			_, bytesJ := Stats(node.Children[keys[j]])
+			return bytesI > bytesJ
+		})
+	}
+}
+
+// countedStats returns the number, aggregated line count, and byte size of the files under the node whose lines
+// were counted, so both totals cover the same files. Files skipped by --max-file-size or that failed to read are left out.
+func countedStats(node *TreeNode) (files, lines int, bytes int64) {
+	if !node.IsDir {
+		if node.Lines < 0 {
+			return 0, 0, 0
+		}
+		return 1, node.Lines, node.Bytes
+	}
+	for _, child := range node.Children {
+		childFiles, childLines, childBytes := countedStats(child)
+		files += childFiles
+		lines += childLines
+		bytes += childBytes
+	}
+	return files, lines, bytes
+}
+
+// formatLines formats a line count, e.g. "1 line" or "320 lines".
+func formatLines(lines int) string {
+	if lines == 1 {
+		return "1 line"
+	}
+	return humanize.Comma(int64(lines)) + " lines"
+}
+
+// formatStats formats the line count and byte size of a node, e.g. "  (320 lines, 8.1 kB)".
+// Files whose lines were not counted show only their size, and directories without any counted file show nothing.
+func formatStats(node *TreeNode) string {
+	if !node.IsDir && node.Lines < 0 {
+		return fmt.Sprintf("  (%s)", humanize.Bytes(uint64(node.Bytes)))
+	}
+	files, lines, bytes := countedStats(node)
+	if files == 0 {
+		return ""
+	}
+	return fmt.Sprintf("  (%s, %s)", formatLines(lines), humanize.Bytes(uint64(bytes)))
+}
+
+// Print generates a hierarchical string representation of the tree.
+// With TreeStylePlain, each level is indented by two spaces.
+// With TreeStyleUnicode, branches are drawn with ├──, └──, and │ connectors like the tree command.
+// Directories deeper than opts.MaxDepth are collapsed to a single line with their file count.
+func Print(node *TreeNode, indent string, opts PrintOptions) string {
+	return printTree(node, indent, opts, 1)
+}
+
+// printTree renders the children of node, which are at the given depth below the root.
+func printTree(node *TreeNode, indent string, opts PrintOptions, depth int) string {
+	var keys []string
+	for k := range node.Children {
+		keys = append(keys, k)
+	}
+	sortKeys(node, keys, opts.Sort, opts.Reverse)
+	var b strings.Builder
+	for i, key := range keys {
+		child := node.Children[key]
+		var stats string
+		if opts.ShowStats {
+			stats = formatStats(child)
+		}
+		name := key
+		collapsed := false
+		if child.IsDir {
+			name += "/"
+			if opts.MaxDepth >= 0 && depth >= opts.MaxDepth {
+				name += formatCollapsed(child)
+				collapsed = true
+			}
+		}
+		var connector, childIndent string
+		switch opts.Style {
+		case TreeStyleUnicode:
+			if i == len(keys)-1 {
+				connector, childIndent = "└── ", indent+"    "
+			} else {
+				connector, childIndent = "├── ", indent+"│   "
+			}
+		default:
+			childIndent = indent + "  "
+		}
+		b.WriteString(indent + connector + name + stats + formatHint(child) + "\n")
+		if child.IsDir && !collapsed {
+			b.WriteString(printTree(child, childIndent, opts, depth+1))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files in testdata with the current output: go test -run Golden -update
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// newTestTree builds a tree of files from slash-separated paths.
+func newTestTree(paths ...string) *TreeNode {
+	var entries []Entry
+	for _, path := range paths {
+		entries = append(entries, Entry{Path: filepath.FromSlash(path)})
+	}
+	return NewTree(entries)
+}
+
+// nestedTreePaths is a fixture with directories nested three levels deep next to a shallow directory and a top-level file.
+var nestedTreePaths = []string{"a/b/c/three.txt", "a/b/two.txt", "a/one.txt", "top.txt", "z/z.txt"}
+
+func TestPrintMaxDepth(t *testing.T) {
+	tree := newTestTree(nestedTreePaths...)
+	tests := []struct {
+		maxDepth int
+		want     string
+	}{
+		{-1, "a/\n  b/\n    c/\n      three.txt\n    two.txt\n  one.txt\nz/\n  z.txt\ntop.txt\n"},
+		{1, "a/ (3 files)\nz/ (1 file)\ntop.txt\n"},
+		{2, "a/\n  b/ (2 files)\n  one.txt\nz/\n  z.txt\ntop.txt\n"},
+		{3, "a/\n  b/\n    c/ (1 file)\n    two.txt\n  one.txt\nz/\n  z.txt\ntop.txt\n"},
+		{4, "a/\n  b/\n    c/\n      three.txt\n    two.txt\n  one.txt\nz/\n  z.txt\ntop.txt\n"},
+	}
+	for _, tt := range tests {
+		got := Print(tree, "", PrintOptions{Style: TreeStylePlain, Sort: SortName, MaxDepth: tt.maxDepth})
+		if got != tt.want {
+			t.Errorf("MaxDepth %d:\n%s\nwant:\n%s", tt.maxDepth, got, tt.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name        string
+		node, other []string
+		want        []string
+	}{
+		{"disjoint", []string{"a/one.txt"}, []string{"b/two.txt"}, []string{"a/one.txt", "b/two.txt"}},
+		{"shared directory", []string{"a/one.txt"}, []string{"a/two.txt"}, []string{"a/one.txt", "a/two.txt"}},
+		{"same file", []string{"a/one.txt"}, []string{"a/one.txt"}, []string{"a/one.txt"}},
+		{"file becomes directory", []string{"a", "b.txt"}, []string{"a/one.txt"}, []string{"a/one.txt", "b.txt"}},
+		{"directory becomes file", []string{"a/one.txt", "b.txt"}, []string{"a"}, []string{"a", "b.txt"}},
+		{"empty other", []string{"a/one.txt"}, nil, []string{"a/one.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, other := newTestTree(tt.node...), newTestTree(tt.other...)
+			Merge(node, other)
+			if got := Paths(node, ""); !slices.Equal(got, tt.want) {
+				t.Errorf("Paths = %q, want %q", got, tt.want)
+			}
+
+			// Changing other afterwards must not change the merged tree
+			for _, path := range tt.other {
+				parts := strings.Split(path, "/")
+				Insert(other, parts, false).Bytes = 42
+				Insert(other, append(slices.Clone(parts[:len(parts)-1]), "added.txt"), false)
+			}
+			if got := Paths(node, ""); !slices.Equal(got, tt.want) {
+				t.Errorf("after changing other, Paths = %q, want %q", got, tt.want)
+			}
+			for _, path := range Paths(node, "") {
+				leaf := node
+				for _, part := range strings.Split(path, "/") {
+					leaf = leaf.Children[part]
+				}
+				if leaf.Bytes != 0 {
+					t.Errorf("%s has Bytes = %d after changing other, want 0", path, leaf.Bytes)
+				}
+			}
+		})
+	}
+}
+
+func TestTreeDepthFlag(t *testing.T) {
+	dir := writeFixture(t, depthFixture)
+	stdout, stderr, err := runGrokker(t, dir, "", "-y", "--action=print", "--format=tree,list", "--tree-style=plain", "--tree-depth=1")
+	if err != nil {
+		t.Fatalf("grokker failed: %v\n%s", err, stderr)
+	}
+	// The tree collapses a/ while the list still has every file
+	want := "./\n  a/ (3 files)\n  top.txt\n\na/b/c/three.txt\na/b/two.txt\na/one.txt\ntop.txt\n"
+	if stdout != want {
+		t.Errorf("stdout:\n%s\nwant:\n%s", stdout, want)
+	}
+}
+
+func TestPrintStyleGolden(t *testing.T) {
+	tree := newTestTree(nestedTreePaths...)
+	for _, tt := range []struct {
+		style TreeStyle
+		file  string
+	}{
+		{TreeStylePlain, "tree_plain.golden"},
+		{TreeStyleUnicode, "tree_unicode.golden"},
+	} {
+		got := Print(tree, "", PrintOptions{Style: tt.style, Sort: SortName, MaxDepth: -1})
+		path := filepath.Join("testdata", tt.file)
+		if *update {
+			if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != string(want) {
+			t.Errorf("%s:\n%s\nwant:\n%s", tt.file, got, want)
+		}
+	}
+}
+
+func TestTreeStatsAcrossBatches(t *testing.T) {
+	files := make(map[string]string)
+	for i := range 2*readBatchSize + 2 {
+		files[fmt.Sprintf("dir%d/file%03d.txt", i%2, i)] = "one\ntwo\n"
+	}
+	dir := writeFixture(t, files)
+	stdout, stderr, err := runGrokker(t, dir, "", "-y", "--action=print", "--format=tree", "--tree-style=plain", "--tree-stats", "--concurrency=4")
+	if err != nil {
+		t.Fatalf("grokker failed: %v\n%s", err, stderr)
+	}
+	want := fmt.Sprintf("./  (%d lines, ", 2*len(files))
+	if !strings.HasPrefix(stdout, want) {
+		t.Errorf("stdout starts with %q, want %q", strings.SplitN(stdout, "\n", 2)[0], want)
+	}
+}
+
+func TestPrintStats(t *testing.T) {
+	tree := newTestTree("a.txt", "big.txt", "sub/c.txt", "sub/d.txt", "skipped/e.txt")
+	for path, stats := range map[string]struct {
+		lines int
+		bytes int64
+	}{
+		"a.txt":         {1, 3},
+		"big.txt":       {-1, 5000}, // Over --max-file-size, so its lines are unknown
+		"sub/c.txt":     {2, 10},
+		"sub/d.txt":     {40, 1000},
+		"skipped/e.txt": {-1, 70},
+	} {
+		node := tree
+		for _, part := range strings.Split(path, "/") {
+			node = node.Children[part]
+		}
+		node.Lines, node.Bytes = stats.lines, stats.bytes
+	}
+	got := formatStats(tree) + "\n" + Print(tree, "", PrintOptions{Style: TreeStylePlain, Sort: SortName, ShowStats: true, MaxDepth: -1})
+	want := "  (43 lines, 1.0 kB)\n" +
+		"skipped/\n" +
+		"  e.txt  (70 B)\n" +
+		"sub/  (42 lines, 1.0 kB)\n" +
+		"  c.txt  (2 lines, 10 B)\n" +
+		"  d.txt  (40 lines, 1.0 kB)\n" +
+		"a.txt  (1 line, 3 B)\n" +
+		"big.txt  (5.0 kB)\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WalkStats records what was skipped while walking the directories.
+type WalkStats struct {
+	IgnoredDirs []string // Directories skipped by the default ignore list
+	TooLarge    int      // Number of files skipped for exceeding --max-size
+	TooSmall    int      // Number of files skipped for being under --min-size
+	Files       int      // Number of files collected, even if the walk was cancelled
+	Errors      []string // Paths skipped because they could not be read, such as directories without permission
+}
+
+// walkEntries walks the directories and collects the files within --dir-depth that match --ext, keyed by directory,
+// followed by the files passed as positional arguments.
+// It also returns what was skipped along the way. The walk stops as soon as ctx is cancelled.
+func walkEntries(ctx context.Context) (entriesByRoot map[string][]Entry, stats WalkStats, err error) {
+	entriesByRoot = make(map[string][]Entry)
+	for _, dir := range dirs {
+		entriesByRoot[dir] = []Entry{}
+		// Track the resolved directories walked so far, so symlinks cannot cause cycles (--follow-symlinks)
+		visited := make(map[string]bool)
+		if realDir, err := filepath.EvalSymlinks(dir); err == nil {
+			visited[realDir] = true
+		}
+		// Always walk the directories passed to --dir, even if they are symlinks
+		start := dir
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			start = dir + string(os.PathSeparator)
+		}
+		if err := walkDir(ctx, dir, start, visited, entriesByRoot, &stats); err != nil {
+			return nil, stats, fmt.Errorf("failed to walk directory: %w", err)
+		}
+	}
+	// Include each file once, even if it is reachable from several directories (e.g., --dir=. and a positional src/)
+	// or, with --follow-symlinks, through several links to the same file
+	seen := make(map[string]bool)
+	deduped := make(map[string]bool)
+	for _, dir := range dirs {
+		if deduped[dir] {
+			continue
+		}
+		deduped[dir] = true
+		var unique []Entry
+		for _, entry := range entriesByRoot[dir] {
+			key, err := fileKey(entry.Path)
+			if err != nil {
+				return nil, stats, err
+			}
+			if seen[key] {
+				slog.Debug("skipped file that was already included", slog.String("path", entry.Path))
+				stats.Files--
+				continue
+			}
+			seen[key] = true
+			unique = append(unique, entry)
+		}
+		entriesByRoot[dir] = unique
+	}
+	if err := addFileEntries(entriesByRoot, argFiles, seen, &stats); err != nil {
+		return nil, stats, err
+	}
+	return entriesByRoot, stats, nil
+}
+
+// fileKey returns the key that identifies a file when deduplicating: its absolute path or,
+// with --follow-symlinks, its absolute path with symlinks resolved, so links to the same file share a key.
+func fileKey(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+	if followSymlinks {
+		if realPath, err := filepath.EvalSymlinks(absPath); err == nil {
+			return realPath, nil
+		}
+	}
+	return absPath, nil
+}
+
+// addFileEntries adds the files passed as positional arguments to entriesByRoot, keyed like readPathEntries.
+// Files are included regardless of --ext, since naming a file explicitly wins over the filters,
+// and files in seen (keys from fileKey of the files already reached by walking a directory) are not added again.
+func addFileEntries(entriesByRoot map[string][]Entry, paths []string, seen map[string]bool, stats *WalkStats) error {
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		key, err := fileKey(path)
+		if err != nil {
+			return err
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat file: %w", err)
+		}
+		root := "."
+		if filepath.IsAbs(path) {
+			root = string(os.PathSeparator)
+		}
+		depth := strings.Count(strings.TrimPrefix(path, string(os.PathSeparator)), string(os.PathSeparator)) + 1
+		entriesByRoot[root] = append(entriesByRoot[root], Entry{Path: path, RelPath: path, IsDir: false, Depth: depth, Size: info.Size(), ModTime: info.ModTime()})
+		stats.Files++
+	}
+	return nil
+}
+
+// walkDir walks start, which is root or a symlinked directory below root, and adds the matching files to entriesByRoot[root].
+// Symlinks are skipped unless --follow-symlinks is set, in which case symlinked files are read as their targets and
+// symlinked directories are walked unless they resolve to a directory that was already visited. Broken symlinks are skipped.
+// It uses filepath.WalkDir, which only stats the entries that need it, rather than filepath.Walk, which stats every entry.
+func walkDir(ctx context.Context, root, start string, visited map[string]bool, entriesByRoot map[string][]Entry, stats *WalkStats) error {
+	return filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return skipWalkError(path, d, err, stats)
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		var depth int
+		if relPath == "." {
+			depth = 0
+		} else {
+			depth = strings.Count(relPath, string(os.PathSeparator)) + 1
+		}
+		isSymlink := d.Type()&fs.ModeSymlink != 0
+		var info fs.FileInfo
+		if isSymlink {
+			if !followSymlinks {
+				slog.Info("skipped symlink", slog.String("path", path))
+				return nil
+			}
+			// Broken symlinks are common (e.g., stale build outputs), so they are skipped without aborting the walk
+			info, err = os.Stat(path)
+			if err != nil {
+				slog.Debug("skipped broken symlink", slog.String("path", path), slog.String("error", err.Error()))
+				return nil
+			}
+		} else if info, err = d.Info(); err != nil {
+			return skipWalkError(path, d, err, stats)
+		}
+		if info.IsDir() && relPath != "." && isDefaultIgnoredDir(info.Name()) {
+			stats.IgnoredDirs = append(stats.IgnoredDirs, path)
+			return filepath.SkipDir
+		}
+		if info.IsDir() && relPath != "." && isExcludedDir(info.Name(), relPath, excludeDirs) {
+			return filepath.SkipDir
+		}
+		// Skip hidden files and directories (--include-hidden)
+		if !includeHidden && relPath != "." && isHidden(info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Depth counts the path components below the root, so the root's own files are at depth 1 and a directory
+		// at depth N only holds files at depth N+1. Skip directories whose files would exceed --dir-depth; --dir-depth=0
+		// skips every directory below the root too, so it means the same as 1.
+		// A symlink is not a directory to filepath.WalkDir, so returning SkipDir for it would skip its siblings instead.
+		if info.IsDir() && relPath != "." && dirDepth != -1 && depth >= dirDepth {
+			if isSymlink {
+				return nil
+			}
+			return filepath.SkipDir
+		}
+		// Walk symlinked directories separately, since filepath.WalkDir does not follow them
+		if isSymlink && info.IsDir() {
+			realPath, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				slog.Error("failed to resolve symlink", slog.String("path", path), slog.String("error", err.Error()))
+				return nil
+			}
+			if isVisited(visited, realPath) {
+				slog.Info("skipped symlink to a directory that was already visited", slog.String("path", path))
+				return nil
+			}
+			visited[realPath] = true
+			return walkDir(ctx, root, path+string(os.PathSeparator), visited, entriesByRoot, stats)
+		}
+		// Skip files outside of --min-size and --max-size
+		if !info.IsDir() && maxSizeBytes > 0 && uint64(info.Size()) > maxSizeBytes {
+			slog.Debug("skipped file over max size", slog.String("path", path), slog.Int64("size", info.Size()))
+			stats.TooLarge++
+			return nil
+		}
+		if !info.IsDir() && uint64(info.Size()) < minSizeBytes {
+			slog.Debug("skipped file under min size", slog.String("path", path), slog.Int64("size", info.Size()))
+			stats.TooSmall++
+			return nil
+		}
+		if !info.IsDir() && isExtIncluded(info.Name()) && isModifiedInRange(info.ModTime()) {
+			entriesByRoot[root] = append(entriesByRoot[root], Entry{Path: filepath.Clean(path), RelPath: relPath, IsDir: false, Depth: depth, Size: info.Size(), ModTime: info.ModTime()})
+			stats.Files++
+		}
+		return nil
+	})
+}
+
+// skipWalkError records a path that could not be read while walking, such as a directory without permission, and
+// skips it so the rest of the walk goes on. With --strict, the error is returned instead, which aborts the walk.
+func skipWalkError(path string, d fs.DirEntry, err error, stats *WalkStats) error {
+	if strict {
+		return err
+	}
+	slog.Debug("skipped unreadable path", slog.String("path", path), slog.String("error", err.Error()))
+	stats.Errors = append(stats.Errors, path)
+	if d != nil && d.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
+
+// isVisited returns true if the resolved directory path or any of its parents was already visited.
+func isVisited(visited map[string]bool, path string) bool {
+	for {
+		if visited[path] {
+			return true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// readPathEntriesFrom reads the file paths listed in the file at path, or stdin if path is "-" (--from-file).
+func readPathEntriesFrom(path string) (map[string][]Entry, error) {
+	if path == "-" {
+		return readPathEntries(os.Stdin)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open from-file: %w", err)
+	}
+	defer file.Close()
+	return readPathEntries(file)
+}
+
+// scanNulls is a bufio.SplitFunc that splits NUL-separated input (e.g., from find -print0).
+func scanNulls(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// readPathEntries reads newline-separated file paths from r and collects the files that match --ext,
+// keyed by "." for relative paths and "/" for absolute paths. Blank lines and lines starting with # are ignored.
+// With -0, the paths are NUL-separated and read verbatim instead.
+// Missing paths are logged and skipped, or returned as an error with --strict, and directories are logged and skipped.
+func readPathEntries(r io.Reader) (map[string][]Entry, error) {
+	entriesByRoot := make(map[string][]Entry)
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	if nullSeparated {
+		scanner.Split(scanNulls)
+	}
+	for scanner.Scan() {
+		path := scanner.Text()
+		if !nullSeparated {
+			path = strings.TrimSpace(path)
+			if strings.HasPrefix(path, "#") {
+				continue
+			}
+		}
+		if path == "" {
+			continue
+		}
+		path = filepath.Clean(path)
+		info, err := os.Stat(path)
+		if err != nil {
+			if strict {
+				return nil, fmt.Errorf("failed to stat file: %w", err)
+			}
+			slog.Error("failed to stat file", slog.String("path", path), slog.String("error", err.Error()))
+			continue
+		}
+		if info.IsDir() {
+			slog.Warn("skipped directory", slog.String("path", path))
+			continue
+		}
+		if seen[path] || !isExtIncluded(info.Name()) || !isModifiedInRange(info.ModTime()) {
+			continue
+		}
+		seen[path] = true
+		root := "."
+		if filepath.IsAbs(path) {
+			root = string(os.PathSeparator)
+		}
+		depth := strings.Count(strings.TrimPrefix(path, string(os.PathSeparator)), string(os.PathSeparator)) + 1
+		entriesByRoot[root] = append(entriesByRoot[root], Entry{Path: path, RelPath: path, IsDir: false, Depth: depth, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read paths: %w", err)
+	}
+	return entriesByRoot, nil
+}
+
+// relativePath returns path relative to cwd, or the absolute path if it is outside cwd (--relative).
+func relativePath(cwd, path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	relPath, err := filepath.Rel(cwd, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(os.PathSeparator)) {
+		return absPath
+	}
+	return relPath
+}
+
+// relativizeEntries rewrites the roots and paths of the entries relative to the working directory (--relative).
+// The files are read through the rewritten paths, which point to the same files.
+func relativizeEntries(entriesByRoot map[string][]Entry) (map[string][]Entry, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	relativized := make(map[string][]Entry, len(entriesByRoot))
+	for root, entries := range entriesByRoot {
+		relRoot := relativePath(cwd, root)
+		for _, entry := range entries {
+			entry.Path = relativePath(cwd, entry.Path)
+			relativized[relRoot] = append(relativized[relRoot], entry)
+		}
+		if _, ok := relativized[relRoot]; !ok {
+			relativized[relRoot] = []Entry{}
+		}
+	}
+	return relativized, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// depthFixture is a tree with one file at each depth, counted in path components below the root.
+var depthFixture = map[string]string{
+	"top.txt":         "top\n",
+	"a/one.txt":       "one\n",
+	"a/b/two.txt":     "two\n",
+	"a/b/c/three.txt": "three\n",
+}
+
+func TestDirDepth(t *testing.T) {
+	dir := writeFixture(t, depthFixture)
+	tests := []struct {
+		depth string
+		want  []string
+	}{
+		{"0", []string{"top.txt"}},
+		{"1", []string{"top.txt"}},
+		{"2", []string{"a/one.txt", "top.txt"}},
+		{"3", []string{"a/b/two.txt", "a/one.txt", "top.txt"}},
+		{"-1", []string{"a/b/c/three.txt", "a/b/two.txt", "a/one.txt", "top.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run("depth="+tt.depth, func(t *testing.T) {
+			if got := listedPaths(t, dir, "--dir-depth="+tt.depth); !slices.Equal(got, tt.want) {
+				t.Errorf("list = %q, want %q", got, tt.want)
+			}
+			if got := contentsPaths(t, dir, "--dir-depth="+tt.depth); !slices.Equal(got, tt.want) {
+				t.Errorf("contents = %q, want %q", got, tt.want)
+			}
+			stdout, stderr, err := runGrokker(t, dir, "", "-y", "--action=print", "--format=tree", "--dir-depth="+tt.depth)
+			if err != nil {
+				t.Fatalf("tree failed: %v\n%s", err, stderr)
+			}
+			var files []string
+			for _, line := range nonEmptyLines(stdout) {
+				if name := strings.TrimSpace(line); strings.HasSuffix(name, ".txt") {
+					files = append(files, name)
+				}
+			}
+			if len(files) != len(tt.want) {
+				t.Errorf("tree has files %q, want %d files\n%s", files, len(tt.want), stdout)
+			}
+		})
+	}
+}
+
+// cancelAfter is a context that reports itself cancelled once Err has been called n times,
+// so a walk or read can be cancelled at a deterministic point partway through.
+type cancelAfter struct {
+	context.Context
+	n atomic.Int64
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n.Add(-1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+// writeLargeTree creates files spread over nested directories in a temporary directory and returns it.
+func writeLargeTree(t *testing.T, files int) string {
+	t.Helper()
+	dir := t.TempDir()
+	for i := range files {
+		path := filepath.Join(dir, fmt.Sprintf("d%d", i%10), fmt.Sprintf("e%d", i%7), fmt.Sprintf("f%d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCancelDuringWalk(t *testing.T) {
+	const files = 2000
+	dir := writeLargeTree(t, files)
+	defer func(d []string, depth int) { dirs, dirDepth = d, depth }(dirs, dirDepth)
+	dirs, dirDepth = []string{dir}, -1
+
+	// Uncancelled, the walk finds every file
+	entriesByRoot, stats, err := walkEntries(context.Background())
+	if err != nil || len(entriesByRoot[dir]) != files {
+		t.Fatalf("walkEntries = %d files, %v, want %d files", len(entriesByRoot[dir]), err, files)
+	}
+
+	// Cancelled partway, it stops with the context's error and reports how many files it had collected
+	ctx := &cancelAfter{Context: context.Background()}
+	ctx.n.Store(files / 2)
+	entriesByRoot, stats, err = walkEntries(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("walkEntries error = %v, want context.Canceled", err)
+	}
+	if entriesByRoot != nil {
+		t.Errorf("walkEntries returned %d roots after cancelling, want nil", len(entriesByRoot))
+	}
+	if stats.Files == 0 || stats.Files >= files {
+		t.Errorf("stats.Files = %d, want a partial count", stats.Files)
+	}
+}
+
+func TestCancelDuringRead(t *testing.T) {
+	dir := writeLargeTree(t, 200)
+	var entries []Entry
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			entries = append(entries, Entry{Path: path, Size: 2})
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(n int, files map[string]error) { concurrency, unreadableFiles = n, files }(concurrency, unreadableFiles)
+	concurrency, unreadableFiles = 4, make(map[string]error)
+
+	ctx := &cancelAfter{Context: context.Background()}
+	ctx.n.Store(50)
+	var read, cancelled int
+	for _, result := range readFiles(ctx, entries) {
+		switch {
+		case result.Err == nil:
+			read++
+		case errors.Is(result.Err, context.Canceled):
+			cancelled++
+		default:
+			t.Errorf("unexpected error: %v", result.Err)
+		}
+	}
+	if read == 0 || cancelled == 0 || read+cancelled != len(entries) {
+		t.Errorf("read %d and cancelled %d of %d files, want both", read, cancelled, len(entries))
+	}
+	// Cancelled reads are not failures, so they are never reported as unreadable files
+	if len(unreadableFiles) != 0 {
+		t.Errorf("unreadableFiles = %v, want none", unreadableFiles)
+	}
+}
+
+func TestOverlappingRoots(t *testing.T) {
+	dir := writeFixture(t, depthFixture)
+	all := []string{"a/b/c/three.txt", "a/b/two.txt", "a/one.txt", "top.txt"}
+	for _, args := range [][]string{
+		{"--dir=.,./a"},
+		{"--dir=./a,."},
+		{"--dir=.,a/b,a"},
+		{"--dir=.", "a/one.txt"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			got := listedPaths(t, dir, args...)
+			for i := range got {
+				got[i] = filepath.ToSlash(filepath.Clean(got[i]))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, all) {
+				t.Errorf("list = %q, want each file once: %q", got, all)
+			}
+			if paths := contentsPaths(t, dir, args...); len(paths) != len(all) {
+				t.Errorf("contents has files %q, want each file once", paths)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+)
+
+// watchDebounce is how long to wait after the last file change before rerunning.
+const watchDebounce = 200 * time.Millisecond
+
+// clearScreen is the ANSI escape sequence to clear the terminal and move the cursor home.
+const clearScreen = "\033[H\033[2J"
+
+// runWatch runs the command once, then reruns it whenever files in the directories, or the files passed as arguments, change.
+// Changes are debounced so a burst of writes (e.g., a save or a git checkout) triggers a single rerun.
+// Errors from reruns are logged rather than returned so the watcher keeps running.
+// It stops watching once ctx is cancelled (e.g., on SIGINT).
+func runWatch(ctx context.Context, cmd *cobra.Command) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+	for _, dir := range dirs {
+		if err := watchDirRecursive(watcher, dir); err != nil {
+			return err
+		}
+	}
+	for _, file := range argFiles {
+		if err := watcher.Add(file); err != nil {
+			return fmt.Errorf("failed to watch file: %w", err)
+		}
+	}
+
+	fmt.Print(clearScreen)
+	if err := run(ctx, cmd); err != nil {
+		return err
+	}
+	// Only confirm once; the user already agreed to process these directories
+	yes = true
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// fsnotify does not watch recursively, so watch new directories as they are created
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchDirRecursive(watcher, event.Name); err != nil {
+						slog.Error("failed to watch directory", slog.String("path", event.Name), slog.String("error", err.Error()))
+					}
+				}
+			}
+			timer.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Error("watcher error", slog.String("error", err.Error()))
+		case <-timer.C:
+			fmt.Print(clearScreen)
+			if err := run(ctx, cmd); err != nil {
+				slog.Error("failed to rerun", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// watchDirRecursive adds the directory and all of its subdirectories to the watcher,
+// skipping directories excluded by --exclude-dir and hidden directories unless --include-hidden is set.
+func watchDirRecursive(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if relPath, err := filepath.Rel(root, path); err == nil && relPath != "." {
+			if isDefaultIgnoredDir(info.Name()) || isExcludedDir(info.Name(), relPath, excludeDirs) || !includeHidden && isHidden(info.Name()) {
+				return filepath.SkipDir
+			}
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch directory: %w", err)
+		}
+		return nil
+	})
+}
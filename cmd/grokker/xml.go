@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// XMLFiles is the root element of the xml format, with one directory element per --dir.
+type XMLFiles struct {
+	XMLName xml.Name  `xml:"files"`
+	Dirs    []*XMLDir `xml:"dir"`
+}
+
+// XMLDir is a directory in the xml format. Subdirectories come before files, like in the tree format.
+type XMLDir struct {
+	Name  string     `xml:"name,attr"`
+	Dirs  []*XMLDir  `xml:"dir"`
+	Files []*XMLFile `xml:"file"`
+}
+
+// XMLFile is a file in the xml format, with its contents wrapped in CDATA.
+// Files that exceed --max-file-size, and binary files with --binary-action=placeholder, have no contents and record why in Skipped.
+type XMLFile struct {
+	Path    string `xml:"path,attr"`
+	Skipped string `xml:"skipped,attr,omitempty"`
+	Content string `xml:",cdata"`
+}
+
+// subdir returns the subdirectory of dir with the given name, adding it if it does not exist yet.
+func (dir *XMLDir) subdir(name string) *XMLDir {
+	for _, sub := range dir.Dirs {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	sub := &XMLDir{Name: name}
+	dir.Dirs = append(dir.Dirs, sub)
+	return sub
+}
+
+// isXMLChar returns true if r is allowed in an XML 1.0 document: tab, newline, carriage return, and every other
+// rune except the remaining control characters, surrogates, U+FFFE, and U+FFFF.
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= utf8.MaxRune
+}
+
+// toXMLChars replaces the runes that XML 1.0 forbids (e.g., form feeds and the ESC of terminal color codes),
+// and invalid UTF-8, with the Unicode replacement character. encoding/xml escapes attributes this way,
+// but writes CDATA as is, so contents must be cleaned before they are marshaled.
+func toXMLChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		if !isXMLChar(r) {
+			return utf8.RuneError
+		}
+		return r
+	}, s)
+}
+
+// renderXML renders the files as an XML document, nesting <dir> elements to mirror the directory tree.
+// Binary files are treated according to --binary-action, and files that fail to read are logged and skipped.
+func renderXML(ctx context.Context, entriesByRoot map[string][]Entry) (string, error) {
+	doc := XMLFiles{}
+	for _, root := range sortedRoots(entriesByRoot) {
+		entries := append([]Entry(nil), entriesByRoot[root]...)
+		if len(entries) == 0 {
+			continue
+		}
+		sortEntries(entries, parsedSortOrder)
+		files := readFiles(ctx, entries)
+		rootDir := &XMLDir{Name: strings.TrimSuffix(root, "/") + "/"}
+		for i, entry := range entries {
+			relPath, err := filepath.Rel(root, entry.Path)
+			if err != nil {
+				return "", fmt.Errorf("failed to get relative path: %w", err)
+			}
+			parts := strings.Split(relPath, string(os.PathSeparator))
+			dir := rootDir
+			for _, part := range parts[:len(parts)-1] {
+				dir = dir.subdir(part)
+			}
+			if files[i].TooLarge {
+				dir.Files = append(dir.Files, &XMLFile{Path: entry.Path, Skipped: "exceeds max-file-size"})
+				continue
+			}
+			if files[i].Err != nil {
+				slog.Debug("skipped unreadable file", slog.String("path", entry.Path), slog.String("error", files[i].Err.Error()))
+				continue
+			}
+			content := string(files[i].Content)
+			if isBinary(files[i].Content) {
+				switch parsedBinaryAction {
+				case BinaryActionPlaceholder:
+					dir.Files = append(dir.Files, &XMLFile{Path: entry.Path, Skipped: "binary file"})
+					continue
+				case BinaryActionInclude:
+					content = hex.Dump(files[i].Content)
+				default:
+					slog.Debug("skipped binary file", slog.String("path", entry.Path))
+					continue
+				}
+			} else {
+				content = redactContent(entry.Path, content)
+			}
+			dir.Files = append(dir.Files, &XMLFile{Path: entry.Path, Content: toXMLChars(content)})
+		}
+		doc.Dirs = append(doc.Dirs, rootDir)
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal xml: %w", err)
+	}
+	return xml.Header + string(out), nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestXMLControlCharacters(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		"colors.txt": "a\x0cb\x1b[31mred\x1b[0m\n",
+		"plain.txt":  "tab\tand <tags> & ]]> end\n",
+	})
+	for _, policy := range []string{"replace", "keep"} {
+		stdout, stderr, err := runGrokker(t, dir, "", "-y", "--action=print", "--format=xml", "--on-invalid-utf8="+policy)
+		if err != nil {
+			t.Fatalf("grokker failed: %v\n%s", err, stderr)
+		}
+		var doc XMLFiles
+		if err := xml.Unmarshal([]byte(stdout), &doc); err != nil {
+			t.Fatalf("output is not well-formed XML: %v\n%s", err, stdout)
+		}
+		contents := make(map[string]string)
+		for _, file := range doc.Dirs[0].Files {
+			contents[file.Path] = file.Content
+		}
+		if got, want := contents["colors.txt"], "a�b�[31mred�[0m\n"; got != want {
+			t.Errorf("colors.txt = %q, want %q", got, want)
+		}
+		if got, want := contents["plain.txt"], "tab\tand <tags> & ]]> end\n"; got != want {
+			t.Errorf("plain.txt = %q, want %q", got, want)
+		}
+		if strings.ContainsAny(stdout, "\x0c\x1b") {
+			t.Errorf("output still has control characters: %q", stdout)
+		}
+	}
+}
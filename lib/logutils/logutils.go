@@ -9,11 +9,19 @@
 //	// Alternatively, configure the logger for JSON formatted output (ideal for structured logging).
 //	logutils.Configure(logutils.Configuration{IsJSONEnabled: true})
 //
+//	// Set the minimum level with any slog.Leveler, such as a slog.Level or a *slog.LevelVar.
+//	logutils.Configure(logutils.Configuration{Level: slog.LevelDebug})
+//
+//	// Capture logs in a buffer instead of writing them to stderr (e.g., in tests).
+//	var buf bytes.Buffer
+//	logutils.Configure(logutils.Configuration{Output: &buf})
+//
 //	// After configuration, use slog for your log messages, for example:
 //	//    slog.Info("Logger configured successfully", "mode", "json or text")
 package logutils
 
 import (
+	"io"
 	"log/slog"
 	"os"
 
@@ -23,8 +31,12 @@ import (
 // Configuration is used to configure the default slog logger.
 // When IsJSONEnabled is true, the logger outputs logs in JSON format suitable for structured logging.
 // When false, the logger uses a text handler (via tint) that produces human-readable logs.
+// Level sets the minimum level for both handlers. A slog.Level such as slog.LevelDebug or slog.LevelWarn can be
+// passed directly, and leaving it unset keeps the default of slog.LevelInfo.
 type Configuration struct {
 	IsJSONEnabled bool
+	Level         slog.Leveler // Minimum level of logs to write; nil means slog.LevelInfo
+	Output        io.Writer    // Destination of the logs; nil means os.Stderr
 }
 
 // Configure sets up the package-level default slog logger based on the provided configuration.
@@ -36,18 +48,26 @@ type Configuration struct {
 //     Ideal for console output and easier visual inspection.
 //
 // Both handlers are configured to:
-//   - Write logs to os.Stderr.
+//   - Write logs to the configured output (os.Stderr by default).
 //   - Include source information (file and line number) via AddSource.
-//   - Log messages at the slog.LevelInfo level or higher.
+//   - Log messages at the configured level or higher (slog.LevelInfo by default).
 func Configure(config Configuration) {
+	level := config.Level
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	output := config.Output
+	if output == nil {
+		output = os.Stderr
+	}
 	if config.IsJSONEnabled {
 		// Using JSON handler for structured log output.
 		slog.SetDefault(slog.New(
 			slog.NewJSONHandler(
-				os.Stderr,
+				output,
 				&slog.HandlerOptions{
 					AddSource: true,
-					Level:     slog.LevelInfo,
+					Level:     level,
 				},
 			),
 		))
@@ -55,10 +75,10 @@ func Configure(config Configuration) {
 		// Using tint's text handler for a more readable, console-friendly log output.
 		slog.SetDefault(slog.New(
 			tint.NewHandler(
-				os.Stderr,
+				output,
 				&tint.Options{
 					AddSource: true,
-					Level:     slog.LevelInfo,
+					Level:     level,
 				},
 			),
 		))